@@ -0,0 +1,36 @@
+import random
+import struct
+import sys
+import zlib
+
+# Writes a png with diagonal gradients and blocks of noise, so there are both busy and quiet paths to find.
+# Usage: python3 CreateTestImage.py output.png width height [seed]
+
+
+def pngChunk(chunkType, data):
+	chunk = chunkType + data
+	return struct.pack(">I", len(data)) + chunk + struct.pack(">I", zlib.crc32(chunk) & 0xffffffff)
+
+
+def createImage(path, width, height, seed):
+	rand = random.Random(seed)
+	rows = []
+	for y in range(height):
+		row = bytearray([0])
+		for x in range(width):
+			value = (x * 7 + y * 3) % 256
+			if (x // 8 + y // 8) % 3 == 0:
+				value = rand.randrange(256)
+			row += bytes([value, x % 256, y % 256, 200 + rand.randrange(56)])
+		rows.append(bytes(row))
+
+	with open(path, "wb") as f:
+		f.write(b"\x89PNG\r\n\x1a\n")
+		f.write(pngChunk(b"IHDR", struct.pack(">IIBBBBB", width, height, 8, 6, 0, 0, 0)))
+		f.write(pngChunk(b"IDAT", zlib.compress(b"".join(rows))))
+		f.write(pngChunk(b"IEND", b""))
+
+
+if __name__ == "__main__":
+	seed = int(sys.argv[4]) if len(sys.argv) > 4 else 1
+	createImage(sys.argv[1], int(sys.argv[2]), int(sys.argv[3]), seed)
@@ -0,0 +1,35 @@
+#!/bin/bash
+# Compares two editor builds on csv_file_1.csv. The image it names is generated at 640x480, each build is
+# run RUNS times and the fastest run is kept. The outputs have to be identical for the speedup to count.
+# Usage: ./benchmark_speedup.sh ./editor_old ./editor_new [editor options, e.g. p=4]
+OLD=$1
+NEW=$2
+shift 2
+RUNS=${RUNS:-3}
+cd "$(dirname "$0")"
+python3 CreateTestImage.py IMG_4061.png 640 480 1
+
+timeRun() {
+	local start end fastest=0
+	for ((run = 0; run < RUNS; run++)); do
+		start=$(date +%s%N)
+		"$@" > /dev/null
+		end=$(date +%s%N)
+		if (( fastest == 0 || end - start < fastest )); then
+			fastest=$(( end - start ))
+		fi
+	done
+	echo $(( fastest / 1000000 ))
+}
+
+old=$(timeRun $OLD csv_file_1.csv "$@")
+mv IMG_4061_Out.png IMG_4061_Old.png
+new=$(timeRun $NEW csv_file_1.csv "$@")
+echo "old: $old ms"
+echo "new: $new ms"
+if cmp -s IMG_4061_Old.png IMG_4061_Out.png; then
+	echo "outputs are identical, speedup $(( old * 10 / new / 10 )).$(( old * 10 / new % 10 ))x"
+else
+	echo "outputs differ"
+fi
+rm -f IMG_4061.png IMG_4061_Old.png IMG_4061_Out.png
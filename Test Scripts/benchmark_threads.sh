@@ -0,0 +1,34 @@
+#!/bin/bash
+# Measures the per seam synchronisation overhead of the concurrent engine. It removes 8 vertical seams from a
+# generated 16x32768 image, which needs a barrier for each of the 32768 rows but very little work per row, and
+# prints how much longer each seam takes at p=2..8 than with the same engine on one thread (p=1). Comparing with
+# p=1 instead of the sequential application leaves out any difference between the two engines.
+# Each setting is run RUNS times and the fastest run is kept to cut down on noise.
+# Pass the editor binary to benchmark so builds can be compared, e.g. ./benchmark_threads.sh ./editor_old
+EDITOR=${1:-./editor}
+RUNS=${RUNS:-5}
+SEAMS=8
+cd "$(dirname "$0")"
+python3 CreateTestImage.py bench.png 16 32768 1
+echo "bench.png,bench_out.png,.5,1" > bench.csv
+
+timeSeam() {
+	local start end fastest=0
+	for ((run = 0; run < RUNS; run++)); do
+		start=$(date +%s%N)
+		$EDITOR bench.csv "$@" > /dev/null
+		end=$(date +%s%N)
+		if (( fastest == 0 || end - start < fastest )); then
+			fastest=$(( end - start ))
+		fi
+	done
+	echo $(( fastest / SEAMS / 1000000 ))
+}
+
+single=$(timeSeam p=1)
+echo "p=1: $single ms per seam"
+for n in 2 4 6 8; do
+	seam=$(timeSeam p=$n)
+	echo "p=$n: $seam ms per seam, $(( seam - single )) ms overhead"
+done
+rm -f bench.png bench.csv bench_out.png
@@ -0,0 +1,50 @@
+#!/bin/bash
+# Runs the distributed application against worker processes on localhost and checks the outputs against the
+# sequential application. One of the workers is killed while the batch is running, so the jobs it had have to
+# be retried on the others, and a worker that never started is listed to check that it's given up on.
+# Usage: ./distributed_localhost.sh [number of workers]
+WORKERS=${1:-3}
+PORT=${PORT:-7100}
+cd "$(dirname "$0")"
+REPO=$(cd .. && pwd)
+WORK=$(mktemp -d)
+pids=()
+trap 'kill "${pids[@]}" 2> /dev/null; rm -rf "$WORK"' EXIT
+
+GO111MODULE=off GOPATH="$REPO" go build -o "$WORK/editor" "$REPO/src/editor" || exit 1
+
+for ((image = 1; image <= 12; image++)); do
+	python3 CreateTestImage.py "$WORK/$image.png" $((150 + image * 10)) $((120 + image * 5)) $image
+	echo "$image.png,seq_$image.png,.8,.7" >> "$WORK/seq.csv"
+	echo "$image.png,dist_$image.png,.8,.7" >> "$WORK/dist.csv"
+done
+"$WORK/editor" "$WORK/seq.csv" > /dev/null
+
+addresses=""
+for ((worker = 0; worker < WORKERS; worker++)); do
+	"$WORK/editor" worker --listen localhost:$((PORT + worker)) > "$WORK/worker_$worker.log" &
+	pids+=($!)
+	addresses+="localhost:$((PORT + worker)),"
+done
+# Nothing listens on this port.
+addresses+="localhost:$((PORT + WORKERS))"
+
+"$WORK/editor" "$WORK/dist.csv" --workers="$addresses" > "$WORK/coordinator.log" &
+coordinator=$!
+sleep 1
+kill -9 "${pids[0]}"
+wait $coordinator
+cat "$WORK/coordinator.log"
+
+failures=0
+for ((image = 1; image <= 12; image++)); do
+	if ! cmp -s "$WORK/seq_$image.png" "$WORK/dist_$image.png"; then
+		echo "dist_$image.png differs from the sequential output"
+		failures=$((failures + 1))
+	fi
+done
+if ((failures > 0)); then
+	echo "$failures failures"
+	exit 1
+fi
+echo "All outputs match the sequential application"
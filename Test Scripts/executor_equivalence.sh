@@ -0,0 +1,63 @@
+#!/bin/bash
+# Checks that every executor writes the same outputs. A batch of synthetic images, each with a weighted layer
+# carved along with it, is compressed by the serial executor, then by the pool executor sharing threads between images and splitting images between threads, by
+# the low memory path and by the distributed executor with workers on localhost, and every output has to be
+# identical to the serial output.
+# Usage: ./executor_equivalence.sh
+PORT=${PORT:-7150}
+cd "$(dirname "$0")"
+REPO=$(cd .. && pwd)
+WORK=$(mktemp -d)
+pids=()
+trap 'kill "${pids[@]}" 2> /dev/null; rm -rf "$WORK"' EXIT
+
+GO111MODULE=off GOPATH="$REPO" go build -o "$WORK/editor" "$REPO/src/editor" || exit 1
+
+sizes="7x5 33x64 97x71 150x120 12x120"
+for size in $sizes; do
+	python3 CreateTestImage.py "$WORK/$size.png" ${size%x*} ${size#*x} ${#size}
+	python3 CreateTestImage.py "$WORK/layer_$size.png" ${size%x*} ${size#*x} 7
+done
+
+# writeCsv writes a line for every image and its layer with outputs named after the prefix.
+writeCsv() {
+	local size
+	for size in $sizes; do
+		echo "$size.png,$1$size.png,.7,.8,layer_$size.png,${1}layer_$size.png,.5"
+	done > "$WORK/$1.csv"
+}
+
+failures=0
+# check runs the editor with the options and compares its outputs with the serial ones.
+check() {
+	local name=$1 prefix=$2 size
+	shift 2
+	writeCsv "$prefix"
+	"$WORK/editor" "$WORK/$prefix.csv" "$@" > "$WORK/$prefix.log"
+	for size in $sizes; do
+		if ! cmp -s "$WORK/serial_$size.png" "$WORK/$prefix$size.png" || ! cmp -s "$WORK/serial_layer_$size.png" "$WORK/${prefix}layer_$size.png"; then
+			echo "$name: $prefix$size.png or its layer differs from the serial output"
+			failures=$((failures + 1))
+			return
+		fi
+	done
+	echo "$name: ok"
+}
+
+writeCsv serial_
+"$WORK/editor" "$WORK/serial_.csv" > /dev/null
+check "pool shared between images" pool_ p=4
+check "pool splitting images" split_ p=16
+check "low memory" lowmem_ --max-memory=1K
+
+"$WORK/editor" worker --listen localhost:$PORT p=2 > "$WORK/worker_0.log" &
+pids+=($!)
+"$WORK/editor" worker --listen localhost:$((PORT + 1)) > "$WORK/worker_1.log" &
+pids+=($!)
+check "distributed" dist_ --workers=localhost:$PORT,localhost:$((PORT + 1))
+
+if ((failures > 0)); then
+	echo "$failures failures"
+	exit 1
+fi
+echo "All executors match the serial executor"
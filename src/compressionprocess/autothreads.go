@@ -0,0 +1,164 @@
+package compressionprocess
+
+import (
+	"encoding/json"
+	"fmt"
+	ic "imagecontainer"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// ThreadProfile stores how long removing a seam takes on this machine with different numbers of threads,
+// so the number of threads for an image can be picked from its size.
+type ThreadProfile struct {
+	NumCPU int
+	Costs  []ThreadCost
+}
+
+// ThreadCost models the time to remove a seam with a number of threads as a fixed cost, mostly spent
+// synchronising the threads, plus a cost for each pixel in the image.
+type ThreadCost struct {
+	Threads       int
+	NanosPerSeam  float64
+	NanosPerPixel float64
+}
+
+// Sizes of the generated images timed while calibrating and the seams removed from each.
+const (
+	calibrationSmallSide = 128
+	calibrationLargeSide = 512
+	calibrationSeams     = 4
+	calibrationRuns      = 3
+)
+
+// seamTime predicts how long removing a seam from an image with the number of pixels takes.
+func (cost ThreadCost) seamTime(pixels int) time.Duration {
+	return time.Duration(cost.NanosPerSeam + cost.NanosPerPixel*float64(pixels))
+}
+
+// DefaultThreadProfilePath returns where the thread profile is kept when no path is given.
+func DefaultThreadProfilePath() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, "GolangImageCompressor", "thread-profile.json")
+}
+
+// LoadThreadProfile reads the profile saved at path. If there isn't one, or it was made on a machine with a
+// different number of CPUs or fewer threads, the threads are calibrated again and the new profile is saved.
+// If path is empty, the profile is calibrated without being saved.
+func LoadThreadProfile(path string, maxThreads int) (*ThreadProfile, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		var profile ThreadProfile
+		if json.Unmarshal(data, &profile) == nil && profile.NumCPU == runtime.NumCPU() && profile.maxThreads() >= maxThreads {
+			return &profile, nil
+		}
+	}
+
+	fmt.Println("Calibrating threads...")
+	profile := CalibrateThreads(maxThreads)
+	if path == "" {
+		return profile, nil
+	}
+	data, err := json.MarshalIndent(profile, "", "\t")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		return profile, err
+	}
+	fmt.Println("Saved thread profile to", path)
+	return profile, nil
+}
+
+// maxThreads returns the most threads the profile has a cost for.
+func (profile *ThreadProfile) maxThreads() int {
+	if len(profile.Costs) == 0 {
+		return 0
+	}
+	return profile.Costs[len(profile.Costs)-1].Threads
+}
+
+// CalibrateThreads times removing seams from a small and a large generated image sequentially and with
+// powers of two threads up to maxThreads, and fits the fixed and per pixel cost of a seam for each.
+func CalibrateThreads(maxThreads int) *ThreadProfile {
+	profile := ThreadProfile{NumCPU: runtime.NumCPU()}
+	smallPixels := calibrationSmallSide * calibrationSmallSide
+	largePixels := calibrationLargeSide * calibrationLargeSide
+	var candidates []int
+	for threads := 1; threads < maxThreads; threads *= 2 {
+		candidates = append(candidates, threads)
+	}
+	// The most threads available are always calibrated, even if it isn't a power of two.
+	candidates = append(candidates, maxThreads)
+	for _, threads := range candidates {
+		profile.Costs = append(profile.Costs, fitThreadCost(threads, smallPixels, largePixels))
+	}
+	return &profile
+}
+
+// fitThreadCost times both generated images with the threads and fits a line through the times.
+func fitThreadCost(threads, smallPixels, largePixels int) ThreadCost {
+	smallTime := timeSeams(calibrationSmallSide, calibrationSmallSide, threads)
+	largeTime := timeSeams(calibrationLargeSide, calibrationLargeSide, threads)
+	cost := ThreadCost{Threads: threads}
+	cost.NanosPerPixel = float64(largeTime-smallTime) / float64(largePixels-smallPixels)
+	if cost.NanosPerPixel < 0 {
+		cost.NanosPerPixel = 0
+	}
+	cost.NanosPerSeam = float64(smallTime) - cost.NanosPerPixel*float64(smallPixels)
+	if cost.NanosPerSeam < 0 {
+		cost.NanosPerSeam = 0
+	}
+	return cost
+}
+
+// timeSeams returns the fastest average time to remove a seam from a generated image over a few runs.
+// Horizontal and vertical seams are removed in turn, the same as when compressing.
+func timeSeams(width, height, threads int) time.Duration {
+	var fastest time.Duration
+	for run := 0; run < calibrationRuns; run++ {
+		imageToProcess := ic.NewImageToProcess("", generateImage(width, height), 0, 0)
+		ctx := imageProcessContext{imageToProcess: imageToProcess, stages: newStageRunner(threads)}
+
+		start := time.Now()
+		for seam := 0; seam < calibrationSeams; seam++ {
+			if seam%2 == 0 {
+				ctx.removeHorizontalSeam()
+			} else {
+				ctx.removeVerticalSeam()
+			}
+		}
+		seamTime := time.Since(start) / calibrationSeams
+		ctx.stages.close()
+		if run == 0 || seamTime < fastest {
+			fastest = seamTime
+		}
+	}
+	return fastest
+}
+
+// BestThreads returns the number of threads, up to maxThreads, predicted to remove a seam from an image with
+// the number of pixels the fastest, along with its predicted time and the predicted time on one thread.
+func (profile *ThreadProfile) BestThreads(pixels, maxThreads int) (threads int, seamTime, sequentialTime time.Duration) {
+	threads = 1
+	for _, cost := range profile.Costs {
+		if cost.Threads > maxThreads {
+			break
+		}
+		predicted := cost.seamTime(pixels)
+		if cost.Threads == 1 {
+			sequentialTime = predicted
+		}
+		if cost.Threads == 1 || predicted < seamTime {
+			threads, seamTime = cost.Threads, predicted
+		}
+	}
+	return threads, seamTime, sequentialTime
+}
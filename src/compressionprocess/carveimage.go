@@ -0,0 +1,47 @@
+package compressionprocess
+
+import (
+	"context"
+	"fmt"
+	ic "imagecontainer"
+)
+
+// CarveImage removes horizontal and vertical seams in turn until the image reaches its target dimensions or
+// the context is done. If the image has a seam limit, each direction stops early at the first seam over it.
+// Unless the image was prepared for the low memory path, which only runs on one thread, every stage of each
+// seam is split between the number of threads given.
+func CarveImage(ctx context.Context, imageToProcess *ic.ImageToProcess, numberOfThreads int) error {
+	return carveImage(ctx, imageToProcess, numberOfThreads, nil)
+}
+
+// carveImage carves the image the same as CarveImage, saving the debug output of its seams with the recorder.
+// The low memory path doesn't keep the magnitudes of the whole image, so it saves none.
+func carveImage(ctx context.Context, imageToProcess *ic.ImageToProcess, numberOfThreads int, debug *debugRecorder) error {
+	var removeHorizontalSeam, removeVerticalSeam func()
+	if imageToProcess.LowMemory() {
+		if debug != nil {
+			fmt.Println("No debug output for", imageToProcess.OutputFileName, "on the low memory path")
+		}
+		removeHorizontalSeam = imageToProcess.RemoveHorizontalSeamLowMemory
+		removeVerticalSeam = imageToProcess.RemoveVerticalSeamLowMemory
+	} else {
+		// A pool of workers lives until the image is done.
+		processContext := imageProcessContext{imageToProcess: imageToProcess, stages: newStageRunner(numberOfThreads), debug: debug}
+		defer processContext.stages.close()
+		removeHorizontalSeam, removeVerticalSeam = processContext.removeHorizontalSeam, processContext.removeVerticalSeam
+	}
+
+	// Process until hit target dimensions
+	for imageToProcess.TargetY < imageToProcess.Height() || imageToProcess.TargetX < imageToProcess.Width() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if imageToProcess.TargetY < imageToProcess.Height() {
+			removeHorizontalSeam()
+		}
+		if imageToProcess.TargetX < imageToProcess.Width() {
+			removeVerticalSeam()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package compressionprocess
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	ic "imagecontainer"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// syntheticImage draws random blocks of colour over noise, so the image has both edges and flat areas.
+func syntheticImage(width, height int, seed int64) *image.RGBA {
+	random := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	random.Read(img.Pix)
+	for block := 0; block < 4; block++ {
+		x, y := random.Intn(width), random.Intn(height)
+		blockColor := color.RGBA{uint8(random.Intn(256)), uint8(random.Intn(256)), uint8(random.Intn(256)), 255}
+		for by := y; by < y+height/3 && by < height; by++ {
+			for bx := x; bx < x+width/3 && bx < width; bx++ {
+				img.SetRGBA(bx, by, blockColor)
+			}
+		}
+	}
+	return img
+}
+
+// carveSynthetic carves a synthetic image to the target size on the number of threads given and returns the
+// output and the seams removed.
+func carveSynthetic(width, height, targetX, targetY, threads int) (*image.RGBA, []ic.Seam, error) {
+	imageToProcess := ic.NewImageToProcess("", syntheticImage(width, height, int64(width*1000+height)), targetX, targetY)
+	imageToProcess.RecordSeams()
+	if err := CarveImage(context.Background(), imageToProcess, threads); err != nil {
+		return nil, nil, err
+	}
+	return imageToProcess.OutputImage().(*image.RGBA), imageToProcess.Seams(), nil
+}
+
+var carveSizes = []struct{ width, height, targetX, targetY int }{
+	{5, 7, 3, 5}, {16, 9, 12, 9}, {31, 40, 22, 32}, {64, 33, 64, 20},
+	{97, 71, 68, 57}, {120, 12, 90, 10}, {12, 120, 9, 100}, {150, 100, 135, 92},
+}
+
+func TestPoolMatchesSerial(t *testing.T) {
+	for _, size := range carveSizes {
+		expected, expectedSeams, err := carveSynthetic(size.width, size.height, size.targetX, size.targetY, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for threads := 1; threads <= 16; threads++ {
+			t.Run(fmt.Sprintf("%dx%d p=%d", size.width, size.height, threads), func(t *testing.T) {
+				output, seams, err := carveSynthetic(size.width, size.height, size.targetX, size.targetY, threads)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if output.Bounds() != expected.Bounds() || !bytes.Equal(output.Pix, expected.Pix) {
+					t.Fatal("output differs from the serial output")
+				}
+				if !reflect.DeepEqual(seams, expectedSeams) {
+					t.Fatal("seams differ from the serial seams")
+				}
+			})
+		}
+	}
+}
+
+// TestConcurrentImagesMatchSerial carves every image at the same time, each on its own pool, so the race detector
+// sees any state shared between images.
+func TestConcurrentImagesMatchSerial(t *testing.T) {
+	outputs := make([]*image.RGBA, len(carveSizes))
+	errs := make([]error, len(carveSizes))
+	var group sync.WaitGroup
+	for i, size := range carveSizes {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			outputs[i], _, errs[i] = carveSynthetic(size.width, size.height, size.targetX, size.targetY, 4)
+		}()
+	}
+	group.Wait()
+	for i, size := range carveSizes {
+		expected, _, err := carveSynthetic(size.width, size.height, size.targetX, size.targetY, 1)
+		if err != nil || errs[i] != nil {
+			t.Fatal(err, errs[i])
+		}
+		if !bytes.Equal(outputs[i].Pix, expected.Pix) {
+			t.Errorf("%dx%d differs from the serial output", size.width, size.height)
+		}
+	}
+}
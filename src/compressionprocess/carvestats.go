@@ -0,0 +1,162 @@
+package compressionprocess
+
+import (
+	"fmt"
+	"image"
+	ic "imagecontainer"
+	"path/filepath"
+	"sort"
+	s "strings"
+)
+
+// edgeFraction is the share of an image's pixels with the most energy that count as its edges.
+const edgeFraction = .1
+
+// CarveStats summarises what a carve took out of an image, to flag carves that cut through important content.
+// EnergyRemoved is the sum of the original energy of every pixel removed and EnergyRemovedFraction is its share of
+// the image's total energy. The seam costs are the sums of the magnitudes along each seam when it was removed.
+// EdgesPreserved is the fraction of the original edges that weren't removed, where the edges are the tenth of the
+// pixels with the most energy.
+type CarveStats struct {
+	Seams                 int
+	EnergyRemoved         float64
+	EnergyRemovedFraction float64
+	MeanSeamCost          float64
+	MaxSeamCost           float64
+	EdgesPreserved        float64
+}
+
+// String prints the statistics on one line for the report.
+func (stats CarveStats) String() string {
+	return fmt.Sprintf("%d seams, %.0f energy removed (%.1f%%), seam cost mean %.1f max %.1f, %.1f%% of edges preserved",
+		stats.Seams, stats.EnergyRemoved, stats.EnergyRemovedFraction*100, stats.MeanSeamCost, stats.MaxSeamCost, stats.EdgesPreserved*100)
+}
+
+// DensityPath returns where the removal density map of an output is written: next to it with the extension
+// .density.png.
+func DensityPath(outputPath string) string {
+	return s.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".density.png"
+}
+
+// writeCarveStats works out the statistics of a carve from the energy of the original image and the seams removed
+// from it, and writes the removal density map next to the output.
+func writeCarveStats(outputPath string, bounds image.Rectangle, energy []float32, seams []ic.Seam) (*CarveStats, error) {
+	removed := removedPixels(bounds, seams)
+	stats := summariseCarve(energy, removed, seams)
+	if _, err := writeImageAtomically(DensityPath(outputPath), densityMap(removed, bounds.Dx(), bounds.Dy()), Overwrite); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// removedPixels marks every pixel of the original image that one of the seams removed, row by row.
+func removedPixels(bounds image.Rectangle, seams []ic.Seam) []bool {
+	removed := make([]bool, bounds.Dx()*bounds.Dy())
+	for _, seam := range seams {
+		for _, point := range seam.Points {
+			point = point.Sub(bounds.Min)
+			removed[point.Y*bounds.Dx()+point.X] = true
+		}
+	}
+	return removed
+}
+
+// summariseCarve adds up the energy removed and the seam costs and counts the edges kept.
+func summariseCarve(energy []float32, removed []bool, seams []ic.Seam) (stats CarveStats) {
+	stats.Seams = len(seams)
+	for _, seam := range seams {
+		stats.MeanSeamCost += float64(seam.Cost)
+		if float64(seam.Cost) > stats.MaxSeamCost {
+			stats.MaxSeamCost = float64(seam.Cost)
+		}
+	}
+	if len(seams) > 0 {
+		stats.MeanSeamCost /= float64(len(seams))
+	}
+
+	var totalEnergy float64
+	for i, value := range energy {
+		totalEnergy += float64(value)
+		if removed[i] {
+			stats.EnergyRemoved += float64(value)
+		}
+	}
+	if totalEnergy > 0 {
+		stats.EnergyRemovedFraction = stats.EnergyRemoved / totalEnergy
+	}
+
+	// Pixels with no energy are never edges, so a flat image keeps all of its (no) edges.
+	threshold := energyPercentile(energy, 100*(1-edgeFraction))
+	edges, kept := 0, 0
+	for i, value := range energy {
+		if value > 0 && value >= threshold {
+			edges++
+			if !removed[i] {
+				kept++
+			}
+		}
+	}
+	stats.EdgesPreserved = 1
+	if edges > 0 {
+		stats.EdgesPreserved = float64(kept) / float64(edges)
+	}
+	return stats
+}
+
+// energyPercentile returns the energy that the percentage of pixels given have at most.
+func energyPercentile(energy []float32, percentile float64) float32 {
+	if len(energy) == 0 {
+		return 0
+	}
+	sorted := append([]float32(nil), energy...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(float64(len(sorted)-1)*percentile/100+.5)]
+}
+
+// densityMap draws the fraction of pixels removed around each pixel of the original image with the heat color
+// map, scaled so the area that lost the most is the brightest. The fraction is taken over a square window whose
+// side is about a sixteenth of the image's shorter side, using a summed area table.
+func densityMap(removed []bool, width, height int) *image.RGBA {
+	radius := width
+	if height < radius {
+		radius = height
+	}
+	radius /= 32
+	if radius < 1 {
+		radius = 1
+	}
+
+	// sums holds the number of removed pixels above and to the left of each pixel, with an extra row and column.
+	sums := make([]int32, (width+1)*(height+1))
+	for y := 0; y < height; y++ {
+		var row int32
+		for x := 0; x < width; x++ {
+			if removed[y*width+x] {
+				row++
+			}
+			sums[(y+1)*(width+1)+x+1] = sums[y*(width+1)+x+1] + row
+		}
+	}
+	density := make([]float64, width*height)
+	var maxDensity float64
+	for y := 0; y < height; y++ {
+		top, bottom := max(y-radius, 0), min(y+radius+1, height)
+		for x := 0; x < width; x++ {
+			left, right := max(x-radius, 0), min(x+radius+1, width)
+			count := sums[bottom*(width+1)+right] - sums[top*(width+1)+right] - sums[bottom*(width+1)+left] + sums[top*(width+1)+left]
+			density[y*width+x] = float64(count) / float64((bottom-top)*(right-left))
+			if density[y*width+x] > maxDensity {
+				maxDensity = density[y*width+x]
+			}
+		}
+	}
+
+	densityImage := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, value := range density {
+		if maxDensity > 0 {
+			value /= maxDensity
+		}
+		densityImage.SetRGBA(i%width, i/width, mapColor(colorMaps["heat"], value))
+	}
+	return densityImage
+}
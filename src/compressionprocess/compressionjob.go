@@ -0,0 +1,295 @@
+package compressionprocess
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	s "strings"
+	"time"
+)
+
+// CompressionJob stores where to read an image from, where to write it and how much to compress it, along with
+// anything else to do with the image while it's compressed.
+type CompressionJob struct {
+	InputPath string
+	// OutputPath can be a template (see expandOutputPath).
+	OutputPath string
+	ScaleRateX string
+	ScaleRateY string
+	// Collision decides what happens when the output already exists.
+	Collision CollisionPolicy
+	// Timeout fails the job once it has run for that long, if it's set.
+	Timeout time.Duration
+	// LowMemory compresses the image on a single thread using less than half the memory (see planMemory).
+	LowMemory bool
+
+	// ThreadProfile picks the number of threads, if it's set.
+	ThreadProfile *ThreadProfile
+	// RecordSeams writes the seams removed next to the output (see SeamFile).
+	RecordSeams bool
+	// Overlay draws the seams over the original image next to the output (see DrawSeams).
+	Overlay OverlayStyle
+	// Layers are carved along with the image and written to their own outputs.
+	Layers []LayerJob
+	// Debug saves the energy and cost of chosen seams (see DebugOptions).
+	Debug *DebugOptions
+	// Stats works out the CarveStats of the image and writes a map of where pixels were removed next to the
+	// output (see DensityPath).
+	Stats bool
+	// SeamCostLimit carves the image until its seams cost too much, with the rates as the smallest size.
+	SeamCostLimit *SeamCostLimit
+}
+
+// LayerJob is another image of the same size carved along with a job's image, such as an alpha mask or a depth
+// map. The same seams are removed from it so the two stay aligned. If Weight isn't 0, the layer's gradient
+// magnitude times the weight is added to the image's when finding seams.
+type LayerJob struct {
+	InputPath  string
+	OutputPath string
+	Weight     float32
+}
+
+// JobResult reports whether a job's image was compressed and written out, and its statistics if they were asked for.
+type JobResult struct {
+	Job   CompressionJob
+	Err   error
+	Stats *CarveStats
+}
+
+// compressJob compresses an image with the given number of threads. It gives up between seams once
+// the context is done or the job's timeout runs out.
+func compressJob(ctx context.Context, job CompressionJob, threads int) (stats *CarveStats, err error) {
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stats, err = processLine(ctx, job, threads)
+	if job.Timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("Timed out after %v: %w", job.Timeout, err)
+	}
+	return stats, err
+}
+
+// runBatch runs a list of jobs through the engine and returns their results in the order they finished.
+func runBatch(jobs []CompressionJob, run func(jobs <-chan CompressionJob, results chan<- JobResult)) []JobResult {
+	results := make(chan JobResult, len(jobs))
+	run(jobChannel(jobs), results)
+	close(results)
+
+	var jobResults []JobResult
+	for result := range results {
+		jobResults = append(jobResults, result)
+	}
+	return jobResults
+}
+
+// jobChannel returns a closed channel holding all of the jobs.
+func jobChannel(jobs []CompressionJob) <-chan CompressionJob {
+	jobChan := make(chan CompressionJob, len(jobs))
+	for _, job := range jobs {
+		jobChan <- job
+	}
+	close(jobChan)
+	return jobChan
+}
+
+// ReadManifest reads a CSV of images to compress and returns a job for each line. Relative paths in the
+// CSV are resolved using the roots (see PathRoots) and lines with paths outside of the roots are skipped.
+// Reading stops at the first line that can't be parsed.
+func ReadManifest(fileName string, roots PathRoots) ([]CompressionJob, error) {
+	path, _ := filepath.Abs(fileName)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	dir := filepath.Dir(path)
+
+	//Try to create a buffered reader.
+	reader := bufio.NewReader(file)
+	var jobs []CompressionJob
+	for {
+		//Stop looping when there are no more lines left.
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return jobs, err
+		}
+		lineValues, parseErr := splitLine(line)
+		if parseErr != nil {
+			// A trailing new line at the end of the file isn't worth reporting.
+			if !(err == io.EOF && line == "") {
+				fmt.Println(parseErr)
+			}
+			break
+		}
+
+		// If there's an input/output location, add the job.
+		if lineValues[0] != "" && lineValues[1] != "" {
+			job, pathErr := newManifestJob(dir, lineValues, roots)
+			if pathErr != nil {
+				fmt.Println(pathErr)
+			} else {
+				jobs = append(jobs, job)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return jobs, nil
+}
+
+// newManifestJob creates a job from the values in a line of a CSV in dir. Any values after the scale rates
+// are layers, three at a time: the layer's input, its output and the weight of its energy (empty for 0).
+func newManifestJob(dir string, lineValues []string, roots PathRoots) (CompressionJob, error) {
+	inputPath, err := roots.resolveInputPath(lineValues[0], dir)
+	if err != nil {
+		return CompressionJob{}, err
+	}
+	outputPath, err := roots.resolveOutputPath(lineValues[1], inputPath, dir)
+	if err != nil {
+		return CompressionJob{}, err
+	}
+	layers, err := newManifestLayers(dir, lineValues[4:], roots)
+	if err != nil {
+		return CompressionJob{}, err
+	}
+	return CompressionJob{
+		InputPath:  inputPath,
+		OutputPath: outputPath,
+		ScaleRateX: lineValues[2],
+		ScaleRateY: lineValues[3],
+		Layers:     layers}, nil
+}
+
+// newManifestLayers creates the layers from the values after the scale rates in a line of a CSV in dir.
+func newManifestLayers(dir string, layerValues []string, roots PathRoots) ([]LayerJob, error) {
+	if len(layerValues)%3 != 0 {
+		return nil, errors.New("Each layer needs an input, an output and a weight: " + s.Join(layerValues, ","))
+	}
+	var layers []LayerJob
+	for i := 0; i < len(layerValues); i += 3 {
+		if layerValues[i] == "" || layerValues[i+1] == "" {
+			return nil, errors.New("Missing Layer Input Or Output Path")
+		}
+		inputPath, err := roots.resolveInputPath(layerValues[i], dir)
+		if err != nil {
+			return nil, err
+		}
+		outputPath, err := roots.resolveOutputPath(layerValues[i+1], inputPath, dir)
+		if err != nil {
+			return nil, err
+		}
+		var weight float64
+		if layerValues[i+2] != "" {
+			weight, err = strconv.ParseFloat(layerValues[i+2], 32)
+			if err != nil || weight < 0 {
+				return nil, errors.New("Invalid layer weight: " + layerValues[i+2])
+			}
+		}
+		layers = append(layers, LayerJob{InputPath: inputPath, OutputPath: outputPath, Weight: float32(weight)})
+	}
+	return layers, nil
+}
+
+// FindImageJobs creates a job for every image in a directory, or for every image matched by a glob pattern,
+// using the same scale rates for each of them. Directories are walked recursively and only files with one of
+// the given extensions are kept. Each output mirrors the input's path relative to the search root inside outputDir.
+func FindImageJobs(pattern, outputDir, scaleRateX, scaleRateY string, extensions []string) ([]CompressionJob, error) {
+	root := globRoot(pattern)
+	// A single file is mirrored straight into the output directory.
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		root = filepath.Dir(root)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, errors.New("No files match " + pattern)
+	}
+
+	var jobs []CompressionJob
+	seen := make(map[string]bool)
+	addJob := func(path string) error {
+		if seen[path] || !hasExtension(path, extensions) {
+			return nil
+		}
+		seen[path] = true
+		relativePath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, CompressionJob{
+			InputPath:  path,
+			OutputPath: filepath.Join(outputDir, relativePath),
+			ScaleRateX: scaleRateX,
+			ScaleRateY: scaleRateY})
+		return nil
+	}
+
+	for _, match := range matches {
+		err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			return addJob(path)
+		})
+		if err != nil {
+			return jobs, err
+		}
+	}
+	return jobs, nil
+}
+
+// IsGlobPattern checks if a path contains any of the special characters used by filepath.Match.
+func IsGlobPattern(path string) bool {
+	return s.ContainsAny(path, `*?[\`)
+}
+
+// globRoot returns the directory at the start of a pattern that doesn't contain any glob characters.
+// If the pattern has no glob characters, the pattern is the root.
+func globRoot(pattern string) string {
+	if !IsGlobPattern(pattern) {
+		return filepath.Clean(pattern)
+	}
+	var rootParts []string
+	for _, part := range s.Split(filepath.ToSlash(pattern), "/") {
+		if IsGlobPattern(part) {
+			break
+		}
+		rootParts = append(rootParts, part)
+	}
+	root := filepath.FromSlash(s.Join(rootParts, "/"))
+	if root == "" && filepath.IsAbs(pattern) {
+		return string(filepath.Separator)
+	}
+	if root == "" {
+		return "."
+	}
+	return root
+}
+
+// hasExtension checks if the path ends with one of the extensions, ignoring case.
+func hasExtension(path string, extensions []string) bool {
+	extension := s.ToLower(filepath.Ext(path))
+	for _, allowed := range extensions {
+		if extension == s.ToLower(allowed) {
+			return true
+		}
+	}
+	return false
+}
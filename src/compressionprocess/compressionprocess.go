@@ -39,20 +39,44 @@ func getImageForFiltering(pathName string) (image.Image, error) {
 	return loadedImage, nil
 }
 
-//ouputImage saves an image to the designated output path.
-func outputImage(imageOutPath string, currentImage image.Image) {
-	if imageOutPath == "" {
-		return
+// ReadImage decodes the png at the path.
+func ReadImage(pathName string) (image.Image, error) {
+	return getImageForFiltering(pathName)
+}
+
+//ouputImage saves an image to the job's output path and returns the path it was written to.
+func outputImage(job CompressionJob, currentImage image.Image) (string, error) {
+	if job.OutputPath == "" {
+		return "", nil
+	}
+	outputPath, err := writeImageAtomically(job.OutputPath, currentImage, job.Collision)
+	if err != nil {
+		fmt.Println("Output Error:", err, outputPath)
 	}
-	// outputFile is a File type which satisfies Writer interface
-	outputFile, err := os.Create(imageOutPath)
-	defer outputFile.Close()
+	return outputPath, err
+}
+
+// prepareOutput works out the output paths of the job and its layers for the target dimensions (see
+// resolveJobOutputPaths). If the output should be skipped, skip is true. Layers whose outputs should be
+// skipped are still carved but get no output path.
+func prepareOutput(job CompressionJob, targetX, targetY int) (CompressionJob, bool, error) {
+	outputPath, layerPaths, skip, err := resolveJobOutputPaths(job, targetX, targetY)
 	if err != nil {
-		fmt.Println("Output Error:", err, imageOutPath)
-		return
+		fmt.Println(job.InputPath, "-", err, outputPath)
+		return job, false, err
 	}
-	// Encode image to png and write to file.
-	png.Encode(outputFile, currentImage)
+	if skip {
+		fmt.Println("Skipping existing output:", outputPath)
+		return job, true, nil
+	}
+	job.OutputPath = outputPath
+	layers := make([]LayerJob, len(job.Layers))
+	for i, layer := range job.Layers {
+		layer.OutputPath = layerPaths[i]
+		layers[i] = layer
+	}
+	job.Layers = layers
+	return job, false, nil
 }
 
 // splitLine reads in a line and makes sure that it has an input line, output line
@@ -78,14 +102,27 @@ func splitLine(line string) (lineData []string, err error) {
 }
 
 // This gets the target dimensions bases on used input or target scale factors.
-func getTargetDimensions(imageInPath, scaleRateX, scaleRateY string, currentImage image.Image) (targetX, targetY int, err error) {
+func getTargetDimensions(imageInPath, scaleRateX, scaleRateY string, imageBounds image.Rectangle) (targetX, targetY int, err error) {
 	scaleFactorX, xErr := strconv.ParseFloat(scaleRateX, 64)
 	scaleFactorY, yErr := strconv.ParseFloat(scaleRateY, 64)
-	targetX = int(float64(currentImage.Bounds().Max.X) * scaleFactorX)
-	targetY = int(float64(currentImage.Bounds().Max.Y) * scaleFactorY)
-	if xErr != nil || yErr != nil || targetX > currentImage.Bounds().Max.X || targetY > currentImage.Bounds().Max.Y {
+	targetX = int(float64(imageBounds.Max.X) * scaleFactorX)
+	targetY = int(float64(imageBounds.Max.Y) * scaleFactorY)
+	if xErr != nil || yErr != nil || targetX > imageBounds.Max.X || targetY > imageBounds.Max.Y {
 		fmt.Println(imageInPath, "- Invalid Scalng Rate:", scaleFactorX, scaleFactorY)
 		err = errors.New("Invalid Target Dimensions.")
 	}
 	return targetX, targetY, err
 }
+
+// smallestTarget raises the target dimensions to the smallest size a job with a seam cost limit is carved to (see
+// LimitedSize) and makes sure they're at least a pixel.
+func smallestTarget(job CompressionJob, targetX, targetY int) (int, int, error) {
+	if job.SeamCostLimit != nil {
+		targetX, targetY = LimitedSize(targetX, targetY)
+	}
+	if targetX < 1 || targetY < 1 {
+		fmt.Println(job.InputPath, "- Target dimensions smaller than a pixel:", targetX, targetY)
+		return targetX, targetY, errors.New("Invalid Target Dimensions.")
+	}
+	return targetX, targetY, nil
+}
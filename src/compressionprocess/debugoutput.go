@@ -0,0 +1,238 @@
+package compressionprocess
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	ic "imagecontainer"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	s "strings"
+)
+
+// DebugOptions saves the energy and the cumulative cost of the seam search for chosen seams while an image is
+// carved, to see why seams went where they did. Steps are the seams to save, counting from 1 across both
+// directions in the order they're removed. Formats can hold png for heatmaps normalised between the smallest
+// and largest value and drawn with the color map, csv for the raw values and npy for the raw values as a NumPy
+// float32 array. Debug output is only saved on the standard path, not for images on the low memory path.
+type DebugOptions struct {
+	Dir      string
+	Steps    []int
+	Formats  []string
+	ColorMap string
+}
+
+// colorMaps holds the colors each color map passes through from the smallest value to the largest.
+var colorMaps = map[string][]color.RGBA{
+	"gray":    {{0, 0, 0, 255}, {255, 255, 255, 255}},
+	"heat":    {{0, 0, 0, 255}, {255, 0, 0, 255}, {255, 255, 0, 255}, {255, 255, 255, 255}},
+	"viridis": {{68, 1, 84, 255}, {59, 82, 139, 255}, {33, 145, 140, 255}, {94, 201, 98, 255}, {253, 231, 37, 255}},
+}
+
+// ParseDebugSteps converts a list of seams such as 1,10,20-25 into the steps to save.
+func ParseDebugSteps(list string) ([]int, error) {
+	var steps []int
+	for _, part := range s.Split(list, ",") {
+		first, last, isRange := s.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		end := start
+		if err == nil && isRange {
+			end, err = strconv.Atoi(last)
+		}
+		if err != nil || start < 1 || end < start {
+			return nil, errors.New("Invalid debug steps: " + list)
+		}
+		for step := start; step <= end; step++ {
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// ParseDebugFormats checks a list of formats such as png,npy.
+func ParseDebugFormats(list string) ([]string, error) {
+	formats := s.Split(s.ToLower(list), ",")
+	for _, format := range formats {
+		if format != "png" && format != "csv" && format != "npy" {
+			return nil, errors.New("Unknown debug format: " + format)
+		}
+	}
+	return formats, nil
+}
+
+// ParseColorMap checks the name of a color map: gray, heat or viridis.
+func ParseColorMap(name string) (string, error) {
+	name = s.ToLower(name)
+	if _, ok := colorMaps[name]; !ok {
+		return "", errors.New("Unknown color map: " + name)
+	}
+	return name, nil
+}
+
+// debugName returns how the debug files of an output start: its file name without the extension.
+func debugName(outputPath string) string {
+	return s.TrimSuffix(filepath.Base(outputPath), filepath.Ext(outputPath))
+}
+
+// debugRecorder saves the debug output of one image. A nil recorder saves nothing.
+type debugRecorder struct {
+	opts  *DebugOptions
+	name  string
+	steps map[int]bool
+	step  int
+}
+
+// newDebugRecorder returns a recorder for an image whose files start with the name, or nil if no debug output
+// was asked for.
+func newDebugRecorder(opts *DebugOptions, name string) *debugRecorder {
+	if opts == nil || len(opts.Steps) == 0 {
+		return nil
+	}
+	recorder := debugRecorder{opts: opts, name: name, steps: make(map[int]bool)}
+	for _, step := range opts.Steps {
+		recorder.steps[step] = true
+	}
+	return &recorder
+}
+
+// nextSeam checks if the next seam removed should be saved. A seam found but left in the image because of the
+// seam cost limit isn't counted, so the next one found is checked again.
+func (recorder *debugRecorder) nextSeam() bool {
+	if recorder == nil {
+		return false
+	}
+	return recorder.steps[recorder.step+1]
+}
+
+// countSeam counts a seam that is being removed.
+func (recorder *debugRecorder) countSeam() {
+	if recorder != nil {
+		recorder.step++
+	}
+}
+
+// save writes the values from the magnitude buffer of the image in every format asked for. The stage is energy
+// or cost. Files that can't be written are reported and skipped, so the image is still carved.
+func (recorder *debugRecorder) save(values [][]float32, vertical bool, stage string) {
+	direction := "horizontal"
+	if vertical {
+		direction = "vertical"
+	}
+	base := filepath.Join(recorder.opts.Dir, fmt.Sprintf("%s_seam%d_%s_%s", recorder.name, recorder.step, direction, stage))
+	for _, format := range recorder.opts.Formats {
+		var write func(file io.Writer) error
+		switch format {
+		case "png":
+			write = func(file io.Writer) error {
+				return png.Encode(file, heatmap(values, recorder.opts.ColorMap))
+			}
+		case "csv":
+			write = func(file io.Writer) error { return writeCsv(file, values) }
+		case "npy":
+			write = func(file io.Writer) error { return writeNpy(file, values) }
+		}
+		if path, err := writeFileAtomically(base+"."+format, write, Overwrite); err != nil {
+			fmt.Println("Debug Output Error:", err, path)
+		}
+	}
+}
+
+// magnitudeRows returns the rows of the magnitude buffer for the current size of the image. If copied is set,
+// the rows are copied out of the buffer so they're kept once it's reused for the next stage.
+func magnitudeRows(imageToProcess *ic.ImageToProcess, copied bool) [][]float32 {
+	width, height := imageToProcess.Width(), imageToProcess.Height()
+	rows := make([][]float32, height)
+	for y := range rows {
+		start := y * imageToProcess.MagnitudeStride
+		rows[y] = imageToProcess.CumulativeMagnitude[start : start+width]
+		if copied {
+			rows[y] = append([]float32(nil), rows[y]...)
+		}
+	}
+	return rows
+}
+
+// heatmap normalises the values between the smallest and largest of them and draws them with the color map.
+func heatmap(values [][]float32, colorMap string) *image.RGBA {
+	minValue, maxValue := float32(math.MaxFloat32), float32(-math.MaxFloat32)
+	for _, row := range values {
+		for _, value := range row {
+			if value < minValue {
+				minValue = value
+			}
+			if value > maxValue {
+				maxValue = value
+			}
+		}
+	}
+	colors := colorMaps[colorMap]
+	if colors == nil {
+		colors = colorMaps["gray"]
+	}
+	heatmapImage := image.NewRGBA(image.Rect(0, 0, len(values[0]), len(values)))
+	for y, row := range values {
+		for x, value := range row {
+			var fraction float64
+			if maxValue > minValue {
+				fraction = float64(value-minValue) / float64(maxValue-minValue)
+			}
+			heatmapImage.SetRGBA(x, y, mapColor(colors, fraction))
+		}
+	}
+	return heatmapImage
+}
+
+// mapColor blends between the two colors of the color map either side of the fraction.
+func mapColor(colors []color.RGBA, fraction float64) color.RGBA {
+	position := fraction * float64(len(colors)-1)
+	index := int(position)
+	if index >= len(colors)-1 {
+		return colors[len(colors)-1]
+	}
+	blend := position - float64(index)
+	from, to := colors[index], colors[index+1]
+	mix := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*blend + .5)
+	}
+	return color.RGBA{mix(from.R, to.R), mix(from.G, to.G), mix(from.B, to.B), 255}
+}
+
+// writeCsv writes a line of comma separated values for each row.
+func writeCsv(file io.Writer, values [][]float32) error {
+	writer := bufio.NewWriter(file)
+	for _, row := range values {
+		for x, value := range row {
+			if x > 0 {
+				writer.WriteString(", ")
+			}
+			writer.WriteString(strconv.FormatFloat(float64(value), 'g', -1, 32))
+		}
+		writer.WriteString("\n")
+	}
+	return writer.Flush()
+}
+
+// writeNpy writes the values as a version 1.0 .npy file holding a little endian float32 array of rows.
+func writeNpy(file io.Writer, values [][]float32) error {
+	header := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", len(values), len(values[0]))
+	// The magic, version, header length and header are padded with spaces to a multiple of 64 bytes.
+	padding := 64 - (10+len(header)+1)%64
+	header += s.Repeat(" ", padding%64) + "\n"
+
+	writer := bufio.NewWriter(file)
+	writer.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(writer, binary.LittleEndian, uint16(len(header)))
+	writer.WriteString(header)
+	for _, row := range values {
+		if err := binary.Write(writer, binary.LittleEndian, row); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,386 @@
+package compressionprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Attempts at sending a job before it fails, and at connecting to a worker before it's given up on.
+const (
+	maxJobAttempts     = 3
+	maxDialAttempts    = 3
+	dialRetryInterval  = time.Second
+	cancelReplyTimeout = 5 * time.Second
+)
+
+// errNoWorkers is returned for jobs left once every worker has stopped responding.
+var errNoWorkers = errors.New("No workers left")
+
+// distributedJob is a job waiting for a worker and how many times it has been sent to one already.
+type distributedJob struct {
+	job      CompressionJob
+	attempts int
+}
+
+// distributedQueue holds the jobs waiting for a worker. Jobs sent to a worker that dies are put back in it.
+type distributedQueue struct {
+	lock     sync.Mutex
+	changed  *sync.Cond
+	pending  []distributedJob
+	inFlight int
+	workers  int
+	closed   bool
+}
+
+// coordinator sends jobs to workers and writes out the images they send back.
+type coordinator struct {
+	ctx     context.Context
+	queue   *distributedQueue
+	results chan<- JobResult
+}
+
+// newDistributedQueue creates an empty queue served by the number of workers.
+func newDistributedQueue(workers int) *distributedQueue {
+	queue := distributedQueue{workers: workers}
+	queue.changed = sync.NewCond(&queue.lock)
+	return &queue
+}
+
+// push queues a job. It returns false if there are no workers left to send it to.
+func (queue *distributedQueue) push(job distributedJob) bool {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	if queue.workers == 0 {
+		return false
+	}
+	queue.pending = append(queue.pending, job)
+	queue.changed.Signal()
+	return true
+}
+
+// next waits for a job and takes it. It returns false once the queue is closed and no job is left or
+// could still be put back.
+func (queue *distributedQueue) next() (distributedJob, bool) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	for len(queue.pending) == 0 && (!queue.closed || queue.inFlight > 0) {
+		queue.changed.Wait()
+	}
+	if len(queue.pending) == 0 {
+		return distributedJob{}, false
+	}
+	job := queue.pending[0]
+	queue.pending = queue.pending[1:]
+	queue.inFlight++
+	return job, true
+}
+
+// finish marks a job taken from the queue as done. If retry is true, it's put back for another worker.
+func (queue *distributedQueue) finish(job distributedJob, retry bool) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	queue.inFlight--
+	if retry {
+		queue.pending = append(queue.pending, job)
+	}
+	queue.changed.Broadcast()
+}
+
+// close stops new jobs being queued, so the workers stop once the queue is empty.
+func (queue *distributedQueue) close() {
+	queue.lock.Lock()
+	queue.closed = true
+	queue.lock.Unlock()
+	queue.changed.Broadcast()
+}
+
+// removeWorker records that a worker has stopped. Once the last worker stops, the jobs still waiting are
+// taken out of the queue and returned so they can be failed.
+func (queue *distributedQueue) removeWorker() []distributedJob {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	queue.workers--
+	if queue.workers > 0 {
+		return nil
+	}
+	abandoned := queue.pending
+	queue.pending = nil
+	return abandoned
+}
+
+// report sends the outcome of a job to the results channel, if there is one.
+func (coordinator *coordinator) report(job CompressionJob, stats *CarveStats, err error) {
+	if coordinator.results != nil {
+		coordinator.results <- JobResult{Job: job, Err: err, Stats: stats}
+	}
+}
+
+// serveWorker sends jobs to the worker at the address one at a time until the queue is empty. If the
+// connection to the worker is lost, the job it was compressing is put back for another worker and the
+// connection is tried again. The worker is given up on once it can't be reconnected to.
+func (coordinator *coordinator) serveWorker(address string) {
+	var client *rpc.Client
+	defer func() {
+		if client != nil {
+			client.Close()
+		}
+		for _, abandoned := range coordinator.queue.removeWorker() {
+			coordinator.report(abandoned.job, nil, errNoWorkers)
+		}
+	}()
+
+	for {
+		job, ok := coordinator.queue.next()
+		if !ok {
+			return
+		}
+		if client == nil {
+			var err error
+			if client, err = dialWorker(address); err != nil {
+				fmt.Println("Giving up on worker", address, "-", err)
+				// The job wasn't sent, so it doesn't count as an attempt.
+				coordinator.queue.finish(job, true)
+				return
+			}
+		}
+
+		stats, err := coordinator.sendJob(client, job.job)
+		if !isConnectionError(err) || coordinator.ctx.Err() != nil {
+			coordinator.queue.finish(job, false)
+			coordinator.report(job.job, stats, err)
+			continue
+		}
+		fmt.Println("Lost worker", address, "compressing", job.job.InputPath, "-", err)
+		client.Close()
+		client = nil
+		job.attempts++
+		retry := job.attempts < maxJobAttempts
+		coordinator.queue.finish(job, retry)
+		if !retry {
+			coordinator.report(job.job, nil, fmt.Errorf("Failed on %d workers: %w", job.attempts, err))
+		}
+	}
+}
+
+// dialWorker connects to a worker, trying a few times in case it's still starting up.
+func dialWorker(address string) (client *rpc.Client, err error) {
+	for attempt := 1; attempt <= maxDialAttempts; attempt++ {
+		if client, err = rpc.Dial("tcp", address); err == nil {
+			return client, nil
+		}
+		if attempt < maxDialAttempts {
+			time.Sleep(dialRetryInterval)
+		}
+	}
+	return nil, err
+}
+
+// isConnectionError checks if a call failed because the connection to the worker was lost, or the worker
+// was stopped, rather than because the worker couldn't compress the image.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var serverErr rpc.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr == errWorkerStopping
+	}
+	var netErr net.Error
+	return errors.Is(err, rpc.ErrShutdown) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// sendJob works out the job's output path, uploads its image to the worker and writes out the compressed
+// image it downloads back, returning its statistics if they were asked for. If the context is done
+// while the worker is compressing, the worker is told to stop.
+func (coordinator *coordinator) sendJob(client *rpc.Client, job CompressionJob) (*CarveStats, error) {
+	if err := coordinator.ctx.Err(); err != nil {
+		return nil, err
+	}
+	// The output path is checked here so no image is sent for an output that won't be written.
+	config, err := readImageConfig(job.InputPath)
+	if err != nil {
+		fmt.Println(job.InputPath, "-", err)
+		return nil, errors.New("Could Not Decode Image")
+	}
+	newX, newY, err := getTargetDimensions(job.InputPath, job.ScaleRateX, job.ScaleRateY, image.Rect(0, 0, config.Width, config.Height))
+	if err != nil {
+		return nil, err
+	}
+	job, skip, err := prepareOutput(job, newX, newY)
+	if skip || err != nil {
+		return nil, err
+	}
+	var id int64
+	if err := client.Call("Worker.Begin", job.InputPath, &id); err != nil {
+		return nil, err
+	}
+	defer client.Call("Worker.Release", id, new(bool))
+	if err := coordinator.upload(client, id, job.InputPath, "input.png"); err != nil {
+		return nil, err
+	}
+	var layers []RemoteLayer
+	for i, layer := range job.Layers {
+		name := fmt.Sprintf("layer_%d.png", i)
+		if err := coordinator.upload(client, id, layer.InputPath, name); err != nil {
+			return nil, err
+		}
+		layers = append(layers, RemoteLayer{Image: name, Weight: layer.Weight})
+	}
+
+	remoteJob := RemoteJob{
+		ID:         id,
+		Name:       job.InputPath,
+		OutputName: filepath.Base(job.OutputPath),
+		Image:      "input.png",
+		ScaleRateX: job.ScaleRateX,
+		ScaleRateY: job.ScaleRateY,
+		Timeout:    job.Timeout,
+
+		RecordSeams:   job.RecordSeams,
+		Overlay:       job.Overlay,
+		Layers:        layers,
+		Debug:         job.Debug,
+		Stats:         job.Stats,
+		SeamCostLimit: job.SeamCostLimit}
+	var result RemoteResult
+	call := client.Go("Worker.Compress", remoteJob, &result, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+	case <-coordinator.ctx.Done():
+		var cancelled bool
+		cancel := client.Go("Worker.Cancel", remoteJob.ID, &cancelled, make(chan *rpc.Call, 1))
+		select {
+		case <-cancel.Done:
+		case <-time.After(cancelReplyTimeout):
+		}
+		return nil, coordinator.ctx.Err()
+	}
+	if call.Error != nil {
+		return nil, call.Error
+	}
+
+	outputPath, err := writeFileAtomically(job.OutputPath, download(client, id, result.Image), job.Collision)
+	if err != nil {
+		fmt.Println("Output Error:", err, outputPath)
+	}
+	for i, layer := range job.Layers {
+		if err == nil && layer.OutputPath != "" {
+			var layerPath string
+			if layerPath, err = writeFileAtomically(layer.OutputPath, download(client, id, result.Layers[i]), layerCollision(job.Collision)); err != nil {
+				fmt.Println("Output Error:", err, layerPath)
+			}
+		}
+	}
+	if err == nil && job.RecordSeams {
+		_, err = writeFileAtomically(SeamFilePath(outputPath), download(client, id, result.Seams), Overwrite)
+	}
+	if err == nil && job.Overlay != NoOverlay {
+		_, err = writeFileAtomically(OverlayPath(outputPath), download(client, id, result.Overlay), Overwrite)
+	}
+	if err == nil && job.Stats {
+		_, err = writeFileAtomically(DensityPath(outputPath), download(client, id, result.Density), Overwrite)
+	}
+	// Debug files are only written if they were asked for, whatever the worker sends back.
+	if job.Debug != nil {
+		for _, name := range result.DebugFiles {
+			if _, debugErr := writeFileAtomically(filepath.Join(job.Debug.Dir, filepath.Base(name)), download(client, id, name), Overwrite); debugErr != nil {
+				fmt.Println("Debug Output Error:", debugErr, name)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.Stats, nil
+}
+
+// upload sends a file to the worker for the job a chunk at a time, under the name given.
+func (coordinator *coordinator) upload(client *rpc.Client, id int64, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buffer := make([]byte, transferChunkSize)
+	chunk := FileChunk{ID: id, File: name}
+	for {
+		if err := coordinator.ctx.Err(); err != nil {
+			return err
+		}
+		n, err := io.ReadFull(file, buffer)
+		if n > 0 {
+			chunk.Data = buffer[:n]
+			if err := client.Call("Worker.Upload", chunk, new(bool)); err != nil {
+				return err
+			}
+			chunk.Offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// download returns a function that copies one of the job's files from the worker a chunk at a time, for
+// writeFileAtomically.
+func download(client *rpc.Client, id int64, name string) func(file io.Writer) error {
+	return func(file io.Writer) error {
+		request := FileRequest{ID: id, File: name}
+		for {
+			var data []byte
+			if err := client.Call("Worker.Download", request, &data); err != nil {
+				return err
+			}
+			if len(data) == 0 {
+				return nil
+			}
+			if _, err := file.Write(data); err != nil {
+				return err
+			}
+			request.Offset += int64(len(data))
+		}
+	}
+}
+
+// DistributedExecutor sends images to the workers at the addresses (see ServeWorker). Each worker compresses
+// one image at a time and the compressed images are written out here. Listing a worker twice sends it two images
+// at once. Jobs on a worker that dies are retried on another, up to maxJobAttempts times.
+type DistributedExecutor struct {
+	Workers []string
+}
+
+// Run sends images to the workers as they arrive until the jobs channel is closed.
+func (executor DistributedExecutor) Run(ctx context.Context, jobs <-chan CompressionJob, results chan<- JobResult) {
+	workers := executor.Workers
+	coordinator := coordinator{ctx: ctx, queue: newDistributedQueue(len(workers)), results: results}
+	var workersRunning sync.WaitGroup
+	for _, address := range workers {
+		workersRunning.Add(1)
+		go func(address string) {
+			defer workersRunning.Done()
+			coordinator.serveWorker(address)
+		}(address)
+	}
+
+	for job := range jobs {
+		if err := ctx.Err(); err != nil {
+			coordinator.report(job, nil, err)
+		} else if !coordinator.queue.push(distributedJob{job: job}) {
+			coordinator.report(job, nil, errNoWorkers)
+		}
+	}
+	coordinator.queue.close()
+	workersRunning.Wait()
+}
@@ -0,0 +1,327 @@
+package compressionprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// transferChunkSize is the most bytes of a file sent in one call between a coordinator and a worker.
+const transferChunkSize = 1 << 20
+
+// RemoteJob is an image for a worker to compress, along with how much to compress it. The image and its layers
+// are uploaded into the job's directory on the worker first (see Begin and Upload) and named by their paths in
+// it. The output's file name is sent so any debug files are named after it.
+type RemoteJob struct {
+	ID         int64
+	Name       string
+	OutputName string
+	Image      string
+	ScaleRateX string
+	ScaleRateY string
+	Timeout    time.Duration
+
+	RecordSeams   bool
+	Overlay       OverlayStyle
+	Layers        []RemoteLayer
+	Debug         *DebugOptions
+	Stats         bool
+	SeamCostLimit *SeamCostLimit
+}
+
+// RemoteLayer is a layer of a RemoteJob (see LayerJob).
+type RemoteLayer struct {
+	Image  string
+	Weight float32
+}
+
+// FileChunk is part of one of a job's files sent to a worker, starting at Offset in the file.
+type FileChunk struct {
+	ID     int64
+	File   string
+	Offset int64
+	Data   []byte
+}
+
+// FileRequest asks a worker for the part of one of a job's files starting at Offset.
+type FileRequest struct {
+	ID     int64
+	File   string
+	Offset int64
+}
+
+// errWorkerStopping is sent back for jobs a worker was stopped in the middle of, so the coordinator knows to
+// send them to another worker.
+const errWorkerStopping = "Worker is stopping"
+
+// RemoteResult names the files a worker wrote for a job in the job's directory, for the coordinator to download:
+// the compressed png, along with its SeamFile if the seams were recorded, its overlay if one was drawn, the png of
+// each of its layers, its debug files and its density map if statistics were asked for. Files that weren't asked
+// for are left empty. The statistics are sent back as they are.
+type RemoteResult struct {
+	Image      string
+	Seams      string
+	Overlay    string
+	Layers     []string
+	DebugFiles []string
+	Stats      *CarveStats
+	Density    string
+}
+
+// CompressionWorker compresses images sent to it by a coordinator (see DistributedExecutor) over net/rpc.
+// Images are compressed one at a time, each with the worker's threads. Files are sent to and from the worker
+// in chunks and kept on disk in a directory for each job, so neither end holds a whole file in memory to send it.
+type CompressionWorker struct {
+	threads   int
+	maxMemory int64
+	ctx       context.Context
+	dir       string
+	slot      chan struct{}
+	lock      sync.Mutex
+	nextID    int64
+	jobDirs   map[int64]string
+	running   map[int64]context.CancelFunc
+	jobs      sync.WaitGroup
+}
+
+// Begin starts a job for the named image, giving it an ID and a directory on the worker for its files.
+func (worker *CompressionWorker) Begin(name string, id *int64) error {
+	if worker.ctx.Err() != nil {
+		return errors.New(errWorkerStopping)
+	}
+	dir, err := os.MkdirTemp(worker.dir, "job")
+	if err != nil {
+		return err
+	}
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	worker.nextID++
+	*id = worker.nextID
+	worker.jobDirs[*id] = dir
+	return nil
+}
+
+// jobFile returns the path of a file in a job's directory. Names are relative to the directory and can't leave it.
+func (worker *CompressionWorker) jobFile(id int64, name string) (string, error) {
+	worker.lock.Lock()
+	dir, ok := worker.jobDirs[id]
+	worker.lock.Unlock()
+	if !ok {
+		return "", fmt.Errorf("Unknown job %d", id)
+	}
+	if !filepath.IsLocal(name) {
+		return "", errors.New("Invalid job file " + name)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Upload writes a chunk of one of a job's input files.
+func (worker *CompressionWorker) Upload(chunk FileChunk, _ *bool) error {
+	path, err := worker.jobFile(chunk.ID, chunk.File)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteAt(chunk.Data, chunk.Offset)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Download reads up to transferChunkSize bytes of one of a job's files. An empty chunk is the end of the file.
+func (worker *CompressionWorker) Download(request FileRequest, data *[]byte) error {
+	path, err := worker.jobFile(request.ID, request.File)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buffer := make([]byte, transferChunkSize)
+	n, err := file.ReadAt(buffer, request.Offset)
+	if err == io.EOF {
+		err = nil
+	}
+	*data = buffer[:n]
+	return err
+}
+
+// Release deletes a job's files once the coordinator is done with them.
+func (worker *CompressionWorker) Release(id int64, _ *bool) error {
+	worker.lock.Lock()
+	dir, ok := worker.jobDirs[id]
+	delete(worker.jobDirs, id)
+	worker.lock.Unlock()
+	if !ok {
+		return nil
+	}
+	return os.RemoveAll(dir)
+}
+
+// Compress compresses the job's uploaded image and sends back the names of the files it wrote.
+func (worker *CompressionWorker) Compress(remoteJob RemoteJob, result *RemoteResult) error {
+	worker.jobs.Add(1)
+	defer worker.jobs.Done()
+	ctx, cancel := context.WithCancel(worker.ctx)
+	defer cancel()
+	worker.lock.Lock()
+	worker.running[remoteJob.ID] = cancel
+	worker.lock.Unlock()
+	defer func() {
+		worker.lock.Lock()
+		delete(worker.running, remoteJob.ID)
+		worker.lock.Unlock()
+	}()
+
+	select {
+	case worker.slot <- struct{}{}:
+		defer func() { <-worker.slot }()
+	case <-ctx.Done():
+		if worker.ctx.Err() != nil {
+			return errors.New(errWorkerStopping)
+		}
+		return ctx.Err()
+	}
+
+	// The engine works on files, so the image is compressed inside the job's directory.
+	inputPath, err := worker.jobFile(remoteJob.ID, remoteJob.Image)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(inputPath)
+	job := CompressionJob{
+		InputPath:  inputPath,
+		OutputPath: filepath.Join(dir, "output", filepath.Base(remoteJob.OutputName)),
+		ScaleRateX: remoteJob.ScaleRateX,
+		ScaleRateY: remoteJob.ScaleRateY,
+		Timeout:    remoteJob.Timeout,
+
+		RecordSeams:   remoteJob.RecordSeams,
+		Overlay:       remoteJob.Overlay,
+		Stats:         remoteJob.Stats,
+		SeamCostLimit: remoteJob.SeamCostLimit}
+	if remoteJob.Debug != nil {
+		debug := *remoteJob.Debug
+		debug.Dir = filepath.Join(dir, "debug")
+		job.Debug = &debug
+	}
+	for i, remoteLayer := range remoteJob.Layers {
+		layerPath, err := worker.jobFile(remoteJob.ID, remoteLayer.Image)
+		if err != nil {
+			return err
+		}
+		job.Layers = append(job.Layers, LayerJob{
+			InputPath:  layerPath,
+			OutputPath: filepath.Join(dir, "output", fmt.Sprintf("layer_%d.png", i)),
+			Weight:     remoteLayer.Weight})
+	}
+
+	threads := worker.threads
+	job, _ = planMemory(job, worker.maxMemory)
+	fmt.Println("Compressing", remoteJob.Name, "with", threads, "threads")
+	if result.Stats, err = compressJob(ctx, job, threads); err != nil {
+		fmt.Println(remoteJob.Name, "-", err)
+		if worker.ctx.Err() != nil {
+			return errors.New(errWorkerStopping)
+		}
+		return err
+	}
+	// The files are named by their paths in the job's directory.
+	name := func(path string) string {
+		name, _ := filepath.Rel(dir, path)
+		return name
+	}
+	result.Image = name(job.OutputPath)
+	for _, layer := range job.Layers {
+		result.Layers = append(result.Layers, name(layer.OutputPath))
+	}
+	if job.RecordSeams {
+		result.Seams = name(SeamFilePath(job.OutputPath))
+	}
+	if job.Overlay != NoOverlay {
+		result.Overlay = name(OverlayPath(job.OutputPath))
+	}
+	if job.Stats {
+		result.Density = name(DensityPath(job.OutputPath))
+	}
+	if job.Debug != nil {
+		entries, err := os.ReadDir(job.Debug.Dir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, entry := range entries {
+			result.DebugFiles = append(result.DebugFiles, name(filepath.Join(job.Debug.Dir, entry.Name())))
+		}
+	}
+	return nil
+}
+
+// Cancel stops the job with the ID at its next seam, if it's still running.
+func (worker *CompressionWorker) Cancel(id int64, cancelled *bool) error {
+	worker.lock.Lock()
+	defer worker.lock.Unlock()
+	if cancel, ok := worker.running[id]; ok {
+		cancel()
+		*cancelled = true
+	}
+	return nil
+}
+
+// ServeWorker listens on the address and compresses the images coordinators send it until the context is
+// done, when the images being compressed are stopped and sent back as failed so they're retried elsewhere.
+// Each image is split between the number of threads given. Job files are kept in a temporary directory that is
+// deleted when the worker stops, along with the files of any job a coordinator didn't release.
+// If maxMemory isn't 0, images that wouldn't fit in it are compressed with less memory (see planMemory).
+func ServeWorker(ctx context.Context, address string, numberOfThreads int, maxMemory int64) error {
+	dir, err := os.MkdirTemp("", "worker")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	worker := CompressionWorker{
+		threads:   numberOfThreads,
+		maxMemory: maxMemory,
+		ctx:       ctx,
+		dir:       dir,
+		slot:      make(chan struct{}, 1),
+		jobDirs:   make(map[int64]string),
+		running:   make(map[int64]context.CancelFunc)}
+	server := rpc.NewServer()
+	if err := server.RegisterName("Worker", &worker); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	fmt.Println("Worker listening on", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				worker.jobs.Wait()
+				return nil
+			}
+			return err
+		}
+		go server.ServeConn(conn)
+	}
+}
@@ -0,0 +1,20 @@
+package compressionprocess
+
+import (
+	"context"
+)
+
+// Executor runs a batch of jobs. Every Executor removes seams with the same engine (see CarveImage), so an
+// image comes out the same whichever one compresses it; they only differ in where the work runs.
+type Executor interface {
+	// Run compresses images as they arrive until the jobs channel is closed. Once the context is done, the
+	// jobs left fail without being started. If results isn't nil, the outcome of each job is sent to it.
+	Run(ctx context.Context, jobs <-chan CompressionJob, results chan<- JobResult)
+}
+
+// LaunchJobs compresses a list of images with the executor and returns the result of each job.
+func LaunchJobs(ctx context.Context, executor Executor, jobs []CompressionJob) []JobResult {
+	return runBatch(jobs, func(jobs <-chan CompressionJob, results chan<- JobResult) {
+		executor.Run(ctx, jobs, results)
+	})
+}
@@ -0,0 +1,157 @@
+package compressionprocess
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeSyntheticImages writes a synthetic image and a layer for it for every size into the directory.
+func writeSyntheticImages(t *testing.T, dir string) {
+	for _, size := range carveSizes {
+		for i, name := range []string{"image", "layer"} {
+			file, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s_%dx%d.png", name, size.width, size.height)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = png.Encode(file, syntheticImage(size.width, size.height, int64(size.width*1000+size.height+i)))
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// syntheticJobs returns a job with a layer and statistics for every synthetic image, writing into the output
+// directory.
+func syntheticJobs(inputDir, outputDir string, lowMemory bool) (jobs []CompressionJob) {
+	for _, size := range carveSizes {
+		name := fmt.Sprintf("%dx%d.png", size.width, size.height)
+		jobs = append(jobs, CompressionJob{
+			InputPath:  filepath.Join(inputDir, "image_"+name),
+			OutputPath: filepath.Join(outputDir, "image_"+name),
+			ScaleRateX: fmt.Sprint(float64(size.targetX) / float64(size.width)),
+			ScaleRateY: fmt.Sprint(float64(size.targetY) / float64(size.height)),
+			LowMemory:  lowMemory,
+			Stats:      true,
+			Layers: []LayerJob{{
+				InputPath:  filepath.Join(inputDir, "layer_"+name),
+				OutputPath: filepath.Join(outputDir, "layer_"+name),
+				Weight:     .5}}})
+	}
+	return jobs
+}
+
+// freeAddress finds a port on localhost that nothing is listening on.
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// waitForWorker waits until the worker at the address accepts connections, failing the test if it stops first or
+// isn't ready within a few seconds.
+func waitForWorker(t *testing.T, address string, workerErr chan error) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		select {
+		case err := <-workerErr:
+			// Put the error back for the deferred wait on the worker.
+			workerErr <- err
+			t.Fatal("Worker stopped:", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Worker didn't start listening on", address)
+		}
+	}
+}
+
+func TestExecutorsMatchSerial(t *testing.T) {
+	inputDir := t.TempDir()
+	writeSyntheticImages(t, inputDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	address := freeAddress(t)
+	workerErr := make(chan error, 1)
+	go func() {
+		workerErr <- ServeWorker(ctx, address, 3, 0)
+	}()
+	// The worker is stopped and its files deleted before the test finishes.
+	defer func() {
+		cancel()
+		<-workerErr
+	}()
+	waitForWorker(t, address, workerErr)
+
+	executors := []struct {
+		name      string
+		executor  Executor
+		lowMemory bool
+	}{
+		{"serial", SerialExecutor{}, false},
+		{"pool", PoolExecutor{Threads: 4}, false},
+		{"low memory", SerialExecutor{}, true},
+		{"distributed", DistributedExecutor{Workers: []string{address, address}}, false},
+	}
+	// Results come back in the order the images finish, so they're matched up by input.
+	var expectedStats map[string]*CarveStats
+	expectedDir := ""
+	for _, executor := range executors {
+		outputDir := t.TempDir()
+		results := LaunchJobs(ctx, executor.executor, syntheticJobs(inputDir, outputDir, executor.lowMemory))
+		for _, result := range results {
+			if result.Err != nil {
+				t.Fatalf("%s: %s: %v", executor.name, result.Job.InputPath, result.Err)
+			}
+		}
+		if expectedStats == nil {
+			expectedStats, expectedDir = map[string]*CarveStats{}, outputDir
+			for _, result := range results {
+				expectedStats[result.Job.InputPath] = result.Stats
+			}
+			continue
+		}
+
+		for _, result := range results {
+			if expected := expectedStats[result.Job.InputPath]; !reflect.DeepEqual(result.Stats, expected) {
+				t.Errorf("%s: %s has statistics %v, serially %v", executor.name, result.Job.InputPath, result.Stats, expected)
+			}
+		}
+		outputs, err := filepath.Glob(filepath.Join(expectedDir, "*.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expectedPath := range outputs {
+			expectedOutput, err := os.ReadFile(expectedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := os.ReadFile(filepath.Join(outputDir, filepath.Base(expectedPath)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(output, expectedOutput) {
+				t.Errorf("%s: %s differs from the serial output", executor.name, filepath.Base(expectedPath))
+			}
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package compressionprocess
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	ic "imagecontainer"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	s "strings"
+)
+
+// indexMapMagic starts every binary index map.
+const indexMapMagic = "SEAMIDX1"
+
+// IndexMap records the order vertical seams were removed from an image, so the image can be shrunk to any width
+// down to MinWidth without finding the seams again. Steps has a value for every pixel, row by row: the seam that
+// removed it, counting from 1, or 0 if it was never removed.
+type IndexMap struct {
+	Width    int
+	Height   int
+	MinWidth int
+	Steps    []uint32
+}
+
+// BuildIndexMap removes vertical seams from the image until it's minWidth wide, splitting each seam between the
+// number of threads given, and records when each pixel was removed.
+func BuildIndexMap(ctx context.Context, sourceImage image.Image, minWidth, numberOfThreads int) (*IndexMap, error) {
+	bounds := sourceImage.Bounds()
+	if minWidth < 1 || minWidth > bounds.Dx() {
+		return nil, errors.New("Invalid Target Dimensions.")
+	}
+	imageToProcess := ic.NewImageToProcess("", sourceImage, minWidth, bounds.Dy())
+	imageToProcess.RecordSeams()
+	if err := CarveImage(ctx, imageToProcess, numberOfThreads); err != nil {
+		return nil, err
+	}
+
+	indexMap := IndexMap{Width: bounds.Dx(), Height: bounds.Dy(), MinWidth: minWidth, Steps: make([]uint32, bounds.Dx()*bounds.Dy())}
+	for step, seam := range imageToProcess.Seams() {
+		for _, point := range seam.Points {
+			point = point.Sub(bounds.Min)
+			indexMap.Steps[point.Y*indexMap.Width+point.X] = uint32(step + 1)
+		}
+	}
+	return &indexMap, nil
+}
+
+// Reconstruct returns the image the map was built from shrunk to the width, keeping the pixels that weren't
+// removed by the first Width - width seams.
+func (indexMap *IndexMap) Reconstruct(sourceImage image.Image, width int) (*image.RGBA, error) {
+	bounds := sourceImage.Bounds()
+	if bounds.Dx() != indexMap.Width || bounds.Dy() != indexMap.Height {
+		return nil, fmt.Errorf("The image is %dx%d but the map is for a %dx%d image", bounds.Dx(), bounds.Dy(), indexMap.Width, indexMap.Height)
+	}
+	if width < indexMap.MinWidth || width > indexMap.Width {
+		return nil, fmt.Errorf("The map only holds widths from %d to %d", indexMap.MinWidth, indexMap.Width)
+	}
+
+	removed := uint32(indexMap.Width - width)
+	output := image.NewRGBA(image.Rect(0, 0, width, indexMap.Height))
+	rgbaImage, isRGBA := sourceImage.(*image.RGBA)
+	for y := 0; y < indexMap.Height; y++ {
+		outputX := 0
+		for x, step := range indexMap.Steps[y*indexMap.Width : (y+1)*indexMap.Width] {
+			if step != 0 && step <= removed {
+				continue
+			}
+			if outputX == width {
+				return nil, errors.New("The map doesn't remove one pixel a row for each seam")
+			}
+			if isRGBA {
+				copy(output.Pix[output.PixOffset(outputX, y):output.PixOffset(outputX, y)+4], rgbaImage.Pix[rgbaImage.PixOffset(bounds.Min.X+x, bounds.Min.Y+y):])
+			} else {
+				output.Set(outputX, y, sourceImage.At(bounds.Min.X+x, bounds.Min.Y+y))
+			}
+			outputX++
+		}
+		if outputX != width {
+			return nil, errors.New("The map doesn't remove one pixel a row for each seam")
+		}
+	}
+	return output, nil
+}
+
+// WriteIndexMap writes the map to the path. Paths ending in .bin get the binary format: "SEAMIDX1", then the
+// width, height and minimum width and every step as little endian uint32s. Otherwise the map is a png, 16 bit
+// gray if every step fits or 32 bit with each step split big endian across the red, green, blue and alpha bytes.
+func WriteIndexMap(path string, indexMap *IndexMap, policy CollisionPolicy) (string, error) {
+	if s.EqualFold(filepath.Ext(path), ".bin") {
+		return writeFileAtomically(path, func(file io.Writer) error {
+			writer := bufio.NewWriter(file)
+			writer.WriteString(indexMapMagic)
+			header := []uint32{uint32(indexMap.Width), uint32(indexMap.Height), uint32(indexMap.MinWidth)}
+			if err := binary.Write(writer, binary.LittleEndian, header); err != nil {
+				return err
+			}
+			if err := binary.Write(writer, binary.LittleEndian, indexMap.Steps); err != nil {
+				return err
+			}
+			return writer.Flush()
+		}, policy)
+	}
+	return writeImageAtomically(path, indexMap.image(), policy)
+}
+
+// maxGray16Seams is the most seams a map can hold as a 16 bit gray image. It's a variable so the tests can write
+// 32 bit maps without removing 65536 seams.
+var maxGray16Seams = math.MaxUint16
+
+// image encodes the map as a 16 bit gray image, or a 32 bit NRGBA image if there are too many seams. The minimum
+// width isn't stored, since it's the number of pixels never removed from a row.
+func (indexMap *IndexMap) image() image.Image {
+	rect := image.Rect(0, 0, indexMap.Width, indexMap.Height)
+	if indexMap.Width-indexMap.MinWidth <= maxGray16Seams {
+		mapImage := image.NewGray16(rect)
+		for i, step := range indexMap.Steps {
+			binary.BigEndian.PutUint16(mapImage.Pix[i*2:], uint16(step))
+		}
+		return mapImage
+	}
+	mapImage := image.NewNRGBA(rect)
+	for i, step := range indexMap.Steps {
+		binary.BigEndian.PutUint32(mapImage.Pix[i*4:], step)
+	}
+	return mapImage
+}
+
+// ReadIndexMap reads a map written by WriteIndexMap.
+func ReadIndexMap(path string) (*IndexMap, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	if magic, err := reader.Peek(len(indexMapMagic)); err == nil && string(magic) == indexMapMagic {
+		reader.Discard(len(indexMapMagic))
+		indexMap, err := readBinaryIndexMap(reader, info.Size()-int64(len(indexMapMagic)))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid index map %s: %v", path, err)
+		}
+		return indexMap, nil
+	}
+
+	mapImage, err := png.Decode(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid index map %s: %v", path, err)
+	}
+	bounds := mapImage.Bounds()
+	indexMap := IndexMap{Width: bounds.Dx(), Height: bounds.Dy(), Steps: make([]uint32, bounds.Dx()*bounds.Dy())}
+	switch mapImage := mapImage.(type) {
+	case *image.Gray16:
+		for i := range indexMap.Steps {
+			indexMap.Steps[i] = uint32(binary.BigEndian.Uint16(mapImage.Pix[i*2:]))
+		}
+	case *image.NRGBA:
+		for i := range indexMap.Steps {
+			indexMap.Steps[i] = binary.BigEndian.Uint32(mapImage.Pix[i*4:])
+		}
+	case *image.RGBA:
+		// A 32 bit map where every alpha byte is 255 is saved without alpha and decoded as RGBA.
+		for i := range indexMap.Steps {
+			indexMap.Steps[i] = binary.BigEndian.Uint32(mapImage.Pix[i*4:])
+		}
+	default:
+		return nil, fmt.Errorf("Invalid index map %s: it isn't a 16 or 32 bit map", path)
+	}
+	// Every row keeps the same number of pixels.
+	for _, step := range indexMap.Steps[:indexMap.Width] {
+		if step == 0 {
+			indexMap.MinWidth++
+		}
+	}
+	if err = indexMap.check(); err != nil {
+		return nil, fmt.Errorf("Invalid index map %s: %v", path, err)
+	}
+	return &indexMap, nil
+}
+
+// readBinaryIndexMap reads the rest of a binary map after its magic, which is size bytes long. The dimensions in
+// the header are checked against the size before anything is allocated for them, and the steps are checked once
+// they're read (see check).
+func readBinaryIndexMap(reader io.Reader, size int64) (*IndexMap, error) {
+	var header [3]uint32
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	indexMap := IndexMap{Width: int(header[0]), Height: int(header[1]), MinWidth: int(header[2])}
+	steps := (size - int64(len(header)*4)) / 4
+	if indexMap.Width <= 0 || indexMap.Height <= 0 || size%4 != 0 || steps%int64(indexMap.Height) != 0 ||
+		steps/int64(indexMap.Height) != int64(indexMap.Width) {
+		return nil, fmt.Errorf("a %dx%d map doesn't match its size of %d bytes", indexMap.Width, indexMap.Height, size)
+	}
+	indexMap.Steps = make([]uint32, indexMap.Width*indexMap.Height)
+	if err := binary.Read(reader, binary.LittleEndian, indexMap.Steps); err != nil {
+		return nil, err
+	}
+	if err := indexMap.check(); err != nil {
+		return nil, err
+	}
+	return &indexMap, nil
+}
+
+// check makes sure the minimum width is from 1 to Width and that every seam from 1 to Width - MinWidth removes
+// exactly one pixel from each row, so every width the map holds can be reconstructed.
+func (indexMap *IndexMap) check() error {
+	if indexMap.MinWidth < 1 || indexMap.MinWidth > indexMap.Width {
+		return fmt.Errorf("a minimum width of %d doesn't fit a %d pixel wide map", indexMap.MinWidth, indexMap.Width)
+	}
+	seams := indexMap.Width - indexMap.MinWidth
+	removed := make([]bool, seams+1)
+	for y := 0; y < indexMap.Height; y++ {
+		clear(removed)
+		count := 0
+		for _, step := range indexMap.Steps[y*indexMap.Width : (y+1)*indexMap.Width] {
+			if step == 0 {
+				continue
+			}
+			if step > uint32(seams) {
+				return fmt.Errorf("row %d has step %d but the map only has %d seams", y, step, seams)
+			}
+			if removed[step] {
+				return fmt.Errorf("row %d has step %d more than once", y, step)
+			}
+			removed[step] = true
+			count++
+		}
+		if count != seams {
+			return fmt.Errorf("row %d has %d removal steps instead of %d", y, count, seams)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package compressionprocess
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeBinaryIndexMap writes a binary index map with the header given, which doesn't have to match the steps.
+func writeBinaryIndexMap(t *testing.T, path string, header []uint32, steps []uint32) {
+	var buffer bytes.Buffer
+	buffer.WriteString(indexMapMagic)
+	binary.Write(&buffer, binary.LittleEndian, header)
+	binary.Write(&buffer, binary.LittleEndian, steps)
+	if err := os.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sameImage checks if two images have the same bounds and pixels. Carved images keep the stride of the image they
+// were carved from, so the pixels are compared a row at a time.
+func sameImage(a, b *image.RGBA) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		rowA := a.Pix[a.PixOffset(bounds.Min.X, y):a.PixOffset(bounds.Max.X, y)]
+		if !bytes.Equal(rowA, b.Pix[b.PixOffset(bounds.Min.X, y):b.PixOffset(bounds.Max.X, y)]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIndexMapMatchesCarving(t *testing.T) {
+	const width, height, minWidth = 40, 24, 12
+	source := syntheticImage(width, height, width*1000+height)
+	indexMap, err := BuildIndexMap(context.Background(), source, minWidth, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	formats := []struct {
+		name        string
+		file        string
+		gray16Seams int
+	}{
+		{"16 bit png", "map.png", maxGray16Seams},
+		// Lowering the limit writes a 32 bit map without removing 65536 seams.
+		{"32 bit png", "map.png", 0},
+		{"binary", "map.bin", maxGray16Seams},
+	}
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			defer func(limit int) { maxGray16Seams = limit }(maxGray16Seams)
+			maxGray16Seams = format.gray16Seams
+			path := filepath.Join(t.TempDir(), format.file)
+			if _, err := WriteIndexMap(path, indexMap, Overwrite); err != nil {
+				t.Fatal(err)
+			}
+			if filepath.Ext(path) == ".png" {
+				file, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				mapImage, err := png.Decode(file)
+				file.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, isGray16 := mapImage.(*image.Gray16); isGray16 != (format.gray16Seams > 0) {
+					t.Fatalf("the map was written as a %T", mapImage)
+				}
+			}
+
+			readMap, err := ReadIndexMap(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if readMap.Width != width || readMap.Height != height || readMap.MinWidth != minWidth {
+				t.Fatalf("read a %dx%d map down to %d", readMap.Width, readMap.Height, readMap.MinWidth)
+			}
+			for _, targetX := range []int{width, 31, 20, minWidth} {
+				expected, _, err := carveSynthetic(width, height, targetX, height, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				output, err := readMap.Reconstruct(source, targetX)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !sameImage(output, expected) {
+					t.Errorf("the map at a width of %d differs from carving", targetX)
+				}
+			}
+		})
+	}
+}
+
+func TestReadIndexMapRejectsCorruptMaps(t *testing.T) {
+	// A valid 3x2 map down to 1 pixel wide.
+	steps := []uint32{1, 0, 2, 2, 1, 0}
+	swapped := []uint32{1, 0, 2, 1, 1, 0}
+	corrupt := []struct {
+		name   string
+		header []uint32
+		steps  []uint32
+	}{
+		{"no width", []uint32{0, 2, 1}, steps},
+		{"wrong size", []uint32{3, 3, 1}, steps},
+		{"truncated", []uint32{3, 2, 1}, steps[:5]},
+		{"no minimum width", []uint32{3, 2, 0}, steps},
+		{"minimum width past the width", []uint32{3, 2, 4}, steps},
+		{"too few steps in a row", []uint32{3, 2, 1}, []uint32{1, 0, 2, 0, 1, 0}},
+		{"step past the seams", []uint32{3, 2, 2}, steps},
+		{"step twice in a row", []uint32{3, 2, 1}, swapped},
+	}
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.bin")
+	writeBinaryIndexMap(t, valid, []uint32{3, 2, 1}, steps)
+	if _, err := ReadIndexMap(valid); err != nil {
+		t.Fatal(err)
+	}
+	for _, corruptMap := range corrupt {
+		t.Run(corruptMap.name, func(t *testing.T) {
+			path := filepath.Join(dir, corruptMap.name+".bin")
+			writeBinaryIndexMap(t, path, corruptMap.header, corruptMap.steps)
+			if indexMap, err := ReadIndexMap(path); err == nil {
+				t.Fatalf("read %+v", indexMap)
+			}
+		})
+	}
+
+	// The minimum width of a png map comes from its first row, so the rows have to agree.
+	mapImage := image.NewGray16(image.Rect(0, 0, 3, 2))
+	for i, step := range []uint16{1, 0, 2, 0, 1, 0} {
+		binary.BigEndian.PutUint16(mapImage.Pix[i*2:], step)
+	}
+	path := filepath.Join(dir, "rows.png")
+	if _, err := WriteImage(path, mapImage, Overwrite); err != nil {
+		t.Fatal(err)
+	}
+	if indexMap, err := ReadIndexMap(path); err == nil {
+		t.Fatalf("read %+v", indexMap)
+	}
+}
@@ -0,0 +1,31 @@
+package compressionprocess
+
+import (
+	"fmt"
+	"image"
+	ic "imagecontainer"
+)
+
+// addLayers loads the job's layers and adds them to the image so they're carved along with it.
+func addLayers(imageToProcess *ic.ImageToProcess, job CompressionJob) error {
+	for _, layer := range job.Layers {
+		layerImage, err := getImageForFiltering(layer.InputPath)
+		if err != nil {
+			return fmt.Errorf("%s - %w", layer.InputPath, err)
+		}
+		if err := imageToProcess.AddLayer(layerImage, layer.Weight); err != nil {
+			return fmt.Errorf("%s - %w", layer.InputPath, err)
+		}
+	}
+	return nil
+}
+
+// outputLayers saves each carved layer to its layer's output path (see layerCollision).
+func outputLayers(job CompressionJob, layerImages []image.Image) error {
+	for i, layerImage := range layerImages {
+		if _, err := outputImage(CompressionJob{OutputPath: job.Layers[i].OutputPath, Collision: layerCollision(job.Collision)}, layerImage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
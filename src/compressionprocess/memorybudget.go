@@ -0,0 +1,129 @@
+package compressionprocess
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	r "regexp"
+	"strconv"
+	s "strings"
+)
+
+// ParseMemorySize converts a size such as 512M, 4G or 4GB into bytes. Sizes are in powers of 1024
+// and a size without a unit is in bytes.
+func ParseMemorySize(size string) (int64, error) {
+	sizeRe := r.MustCompile(`^(\d+(?:\.\d+)?)([KMGT]?)B?$`)
+	match := sizeRe.FindStringSubmatch(s.ToUpper(s.TrimSpace(size)))
+	if match == nil {
+		return 0, errors.New("Invalid memory size: " + size)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, errors.New("Invalid memory size: " + size)
+	}
+	if match[2] != "" {
+		value *= float64(int64(1) << (10 * (s.Index("KMGT", match[2]) + 1)))
+	}
+	return int64(value), nil
+}
+
+// formatMemory prints a number of bytes in megabytes, or kilobytes for less than a megabyte.
+func formatMemory(bytes int64) string {
+	if bytes < 1<<20 {
+		return fmt.Sprintf("%d KB", (bytes+1<<10-1)>>10)
+	}
+	return fmt.Sprintf("%d MB", (bytes+1<<20-1)>>20)
+}
+
+// readImageConfig reads the size and color model from an image's header.
+func readImageConfig(path string) (image.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	return config, err
+}
+
+// decodedBytesPerPixel returns how many bytes a pixel takes once an image with the color model is decoded.
+func decodedBytesPerPixel(colorModel color.Model) int64 {
+	switch colorModel {
+	case color.GrayModel:
+		return 1
+	case color.Gray16Model:
+		return 2
+	case color.RGBA64Model, color.NRGBA64Model:
+		return 8
+	}
+	if _, ok := colorModel.(color.Palette); ok {
+		return 1
+	}
+	return 4
+}
+
+// estimateMemory estimates how many bytes compressing a job's image takes at its peak. The standard path
+// holds the decoded image, an RGBA copy of it and a float32 magnitude for every pixel. The low memory
+// path compresses 8 bit RGBA images in the decoded image itself and only keeps a byte for every pixel
+// to trace the seam back (see ic.NewLowMemoryImageToProcess). On either path, recording the seams for
+// --seams, --overlay or --stats keeps the original position of every pixel, the statistics and percentile
+// seam cost limits keep the original energy of every pixel, and the job's layers are held as well.
+func estimateMemory(job CompressionJob, config image.Config) (standard, lowMemory int64) {
+	pixels := int64(config.Width) * int64(config.Height)
+	decoded := pixels * decodedBytesPerPixel(config.ColorModel)
+	standard = decoded + pixels*4 + pixels*4
+	lowMemory = decoded + pixels*4 + pixels
+	if config.ColorModel == color.RGBAModel || config.ColorModel == color.NRGBAModel {
+		lowMemory = decoded + pixels
+	}
+
+	extra := estimateLayerMemory(job)
+	if job.RecordSeams || job.Overlay != NoOverlay || job.Stats {
+		extra += pixels * 4
+	}
+	if job.Stats || (job.SeamCostLimit != nil && job.SeamCostLimit.Percentile) {
+		extra += pixels * 4
+	}
+	return standard + extra, lowMemory + extra
+}
+
+// estimateLayerMemory estimates how many bytes a job's layers take on top of its image. Each layer holds its
+// decoded image and an RGBA copy of it on either path.
+func estimateLayerMemory(job CompressionJob) (layerMemory int64) {
+	for _, layer := range job.Layers {
+		config, err := readImageConfig(layer.InputPath)
+		if err != nil {
+			continue
+		}
+		pixels := int64(config.Width) * int64(config.Height)
+		layerMemory += pixels*decodedBytesPerPixel(config.ColorModel) + pixels*4
+	}
+	return layerMemory
+}
+
+// planMemory estimates how much memory a job needs within the budget. Jobs that don't fit in the budget
+// on their own are switched to the low memory path. If even that doesn't fit, the job is given the whole
+// budget so it runs by itself. A budget of 0 means there's no limit.
+func planMemory(job CompressionJob, maxMemory int64) (CompressionJob, int64) {
+	if maxMemory <= 0 {
+		return job, 0
+	}
+	config, err := readImageConfig(job.InputPath)
+	if err != nil {
+		// The job will fail when the image is loaded.
+		return job, 0
+	}
+	standard, lowMemory := estimateMemory(job, config)
+	if standard <= maxMemory {
+		return job, standard
+	}
+	job.LowMemory = true
+	if lowMemory > maxMemory {
+		fmt.Println(job.InputPath, "needs about", formatMemory(lowMemory), "even with less memory, so it will be compressed on its own")
+		return job, maxMemory
+	}
+	fmt.Println(job.InputPath, "needs about", formatMemory(standard), "so it will be compressed with", formatMemory(lowMemory))
+	return job, lowMemory
+}
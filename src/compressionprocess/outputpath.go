@@ -0,0 +1,340 @@
+package compressionprocess
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	r "regexp"
+	"strconv"
+	s "strings"
+	"sync"
+)
+
+// CollisionPolicy decides what happens when an output file already exists.
+type CollisionPolicy int
+
+// Constants for collision policies
+const (
+	Overwrite CollisionPolicy = iota
+	Skip
+	Suffix
+	Fail
+)
+
+// ErrOutputExists is returned for jobs using the Fail policy when their output already exists.
+var ErrOutputExists = errors.New("Output Already Exists")
+
+// partialOutputs stores the temporary files that are being written, so they can be removed if the
+// process has to exit before they're moved into place.
+var partialOutputs = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// ParseCollisionPolicy converts overwrite, skip, suffix or fail into a CollisionPolicy.
+func ParseCollisionPolicy(name string) (CollisionPolicy, error) {
+	switch s.ToLower(name) {
+	case "overwrite":
+		return Overwrite, nil
+	case "skip":
+		return Skip, nil
+	case "suffix":
+		return Suffix, nil
+	case "fail":
+		return Fail, nil
+	}
+	return Overwrite, errors.New("Unknown collision policy: " + name)
+}
+
+// ApplyNameTemplate swaps the file name of an output path for a template such as {name}_{w}x{h}.{ext}.
+func ApplyNameTemplate(outputPath, nameTemplate string) string {
+	if nameTemplate == "" {
+		return outputPath
+	}
+	return filepath.Join(filepath.Dir(outputPath), nameTemplate)
+}
+
+// expandOutputPath fills in the fields of an output path template using the job's input and the
+// dimensions of the compressed image. The fields are {name} and {ext} of the input file, the input's
+// {dir}, the output's {w} and {h} and a {hash} of the input file's contents.
+func expandOutputPath(job CompressionJob, width, height int) (string, error) {
+	if !s.Contains(job.OutputPath, "{") {
+		return job.OutputPath, nil
+	}
+	var templateErr error
+	fieldRe := r.MustCompile(`\{[a-z]*\}`)
+	outputPath := fieldRe.ReplaceAllStringFunc(job.OutputPath, func(field string) string {
+		extension := filepath.Ext(job.InputPath)
+		switch field {
+		case "{name}":
+			return s.TrimSuffix(filepath.Base(job.InputPath), extension)
+		case "{ext}":
+			return s.TrimPrefix(extension, ".")
+		case "{dir}":
+			return filepath.Dir(job.InputPath)
+		case "{w}", "{h}":
+			if job.SeamCostLimit != nil {
+				templateErr = errors.New("Output templates can't use {w} or {h} with a seam cost limit, since the size isn't known until the image is carved")
+			} else if field == "{w}" {
+				return strconv.Itoa(width)
+			}
+			return strconv.Itoa(height)
+		case "{hash}":
+			hash, err := hashFile(job.InputPath)
+			if err != nil {
+				templateErr = err
+			}
+			return hash
+		}
+		templateErr = errors.New("Unknown output template field " + field)
+		return field
+	})
+	return outputPath, templateErr
+}
+
+// hashFile returns the first 12 hex characters of the sha256 of a file.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
+
+// resolveOutputPath expands the job's output template and applies its collision policy. If the output
+// should be skipped, skip is true. This is checked before compressing so no work is wasted on an image
+// that won't be written, and again when the image is written out.
+func resolveOutputPath(job CompressionJob, width, height int) (outputPath string, skip bool, err error) {
+	outputPath, err = expandOutputPath(job, width, height)
+	if err != nil || outputPath == "" {
+		return outputPath, false, err
+	}
+	if _, statErr := os.Stat(outputPath); os.IsNotExist(statErr) {
+		return outputPath, false, nil
+	}
+	switch job.Collision {
+	case Skip:
+		return outputPath, true, nil
+	case Fail:
+		return outputPath, false, ErrOutputExists
+	case Suffix:
+		return nextFreePath(outputPath), false, nil
+	}
+	return outputPath, false, nil
+}
+
+// nextFreePath adds _1, _2 and so on before the extension until the path doesn't exist.
+func nextFreePath(path string) string {
+	for suffix := 1; ; suffix++ {
+		if suffixedPath := addSuffix(path, suffix); !pathExists(suffixedPath) {
+			return suffixedPath
+		}
+	}
+}
+
+// addSuffix adds _ and the number before the path's extension. A suffix of 0 leaves the path as it is.
+func addSuffix(path string, suffix int) string {
+	if suffix == 0 || path == "" {
+		return path
+	}
+	extension := filepath.Ext(path)
+	return s.TrimSuffix(path, extension) + "_" + strconv.Itoa(suffix) + extension
+}
+
+// pathExists checks if anything is at the path.
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return !os.IsNotExist(err)
+}
+
+// resolveJobOutputPaths resolves the job's output path and its layers' output paths the same as
+// resolveOutputPath. Under the Suffix policy, they all get the first suffix that's free for every one of them,
+// so an image and its layers stay paired. A layer whose output should be skipped gets an empty path.
+func resolveJobOutputPaths(job CompressionJob, width, height int) (outputPath string, layerPaths []string, skip bool, err error) {
+	if job.Collision != Suffix || len(job.Layers) == 0 {
+		outputPath, skip, err = resolveOutputPath(job, width, height)
+		if err != nil || skip {
+			return outputPath, nil, skip, err
+		}
+	} else if outputPath, err = expandOutputPath(job, width, height); err != nil {
+		return outputPath, nil, false, err
+	}
+
+	for _, layer := range job.Layers {
+		layerJob := job
+		layerJob.InputPath, layerJob.OutputPath, layerJob.Layers = layer.InputPath, layer.OutputPath, nil
+		var layerPath string
+		var layerSkip bool
+		if job.Collision == Suffix {
+			layerPath, err = expandOutputPath(layerJob, width, height)
+		} else {
+			layerPath, layerSkip, err = resolveOutputPath(layerJob, width, height)
+		}
+		if err != nil {
+			return outputPath, nil, false, fmt.Errorf("%s - %w", layer.InputPath, err)
+		}
+		if layerSkip {
+			layerPath = ""
+		}
+		layerPaths = append(layerPaths, layerPath)
+	}
+	if job.Collision != Suffix {
+		return outputPath, layerPaths, false, nil
+	}
+
+	paths := append([]string{outputPath}, layerPaths...)
+	for suffix := 0; ; suffix++ {
+		free := true
+		for _, path := range paths {
+			if path != "" && pathExists(addSuffix(path, suffix)) {
+				free = false
+				break
+			}
+		}
+		if free {
+			for i := range layerPaths {
+				layerPaths[i] = addSuffix(layerPaths[i], suffix)
+			}
+			return addSuffix(outputPath, suffix), layerPaths, false, nil
+		}
+	}
+}
+
+// layerCollision is the policy layer outputs are written with. Under the Suffix policy, a layer's path was
+// chosen along with its image's, so writing it fails instead of taking another suffix if a file has been
+// created there since.
+func layerCollision(policy CollisionPolicy) CollisionPolicy {
+	if policy == Suffix {
+		return Fail
+	}
+	return policy
+}
+
+// writeImageAtomically encodes the image into a temporary file next to the output and then moves it
+// into place, so a crash never leaves a truncated png behind. Unless the policy is Overwrite, the move
+// fails if another job created the output first.
+func writeImageAtomically(outputPath string, currentImage image.Image, policy CollisionPolicy) (string, error) {
+	return writeFileAtomically(outputPath, func(file io.Writer) error {
+		return png.Encode(file, currentImage)
+	}, policy)
+}
+
+// WriteImage writes the image to the path as a png the same way outputs are written (see writeImageAtomically)
+// and returns the path it was written to.
+func WriteImage(outputPath string, currentImage image.Image, policy CollisionPolicy) (string, error) {
+	return writeImageAtomically(outputPath, currentImage, policy)
+}
+
+// writeFileAtomically writes a file the same way as writeImageAtomically, with write filling in its contents.
+func writeFileAtomically(outputPath string, write func(file io.Writer) error, policy CollisionPolicy) (string, error) {
+	// Mirrored directory inputs may need their sub directories created.
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return outputPath, err
+	}
+	tempFile, err := createTempFile(outputPath)
+	if err != nil {
+		return outputPath, err
+	}
+	tempPath := tempFile.Name()
+	trackPartialOutput(tempPath, true)
+	defer func() {
+		os.Remove(tempPath)
+		trackPartialOutput(tempPath, false)
+	}()
+
+	err = write(tempFile)
+	// A file being overwritten keeps its mode.
+	if info, statErr := os.Stat(outputPath); err == nil && statErr == nil && policy == Overwrite {
+		err = tempFile.Chmod(info.Mode().Perm())
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return outputPath, err
+	}
+	if policy == Overwrite {
+		return outputPath, os.Rename(tempPath, outputPath)
+	}
+
+	// Linking fails instead of replacing a file that appeared while the image was being compressed.
+	for {
+		err = linkNewFile(tempPath, outputPath)
+		if !os.IsExist(err) {
+			return outputPath, err
+		}
+		switch policy {
+		case Skip:
+			fmt.Println("Skipping existing output:", outputPath)
+			return outputPath, nil
+		case Fail:
+			return outputPath, ErrOutputExists
+		}
+		outputPath = nextFreePath(outputPath)
+	}
+}
+
+// createTempFile creates a temporary file next to the output with the same mode a new output would get, 0666
+// less the umask. os.CreateTemp would make it 0600, which moving it into place would keep.
+func createTempFile(outputPath string) (*os.File, error) {
+	prefix := filepath.Join(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".tmp")
+	for attempt := 0; ; attempt++ {
+		tempFile, err := os.OpenFile(prefix+strconv.FormatUint(uint64(rand.Uint32()), 10), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !os.IsExist(err) || attempt == 100 {
+			return tempFile, err
+		}
+	}
+}
+
+// linkNewFile moves the temporary file to the path unless a file is already there, returning an error that
+// os.IsExist reports if one is. It hard links the file into place or, on file systems without hard links
+// such as FAT, creates the path exclusively and then renames the file over it.
+func linkNewFile(tempPath, outputPath string) error {
+	err := os.Link(tempPath, outputPath)
+	if err == nil || os.IsExist(err) {
+		return err
+	}
+	placeholder, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	placeholder.Close()
+	if err = os.Rename(tempPath, outputPath); err != nil {
+		os.Remove(outputPath)
+	}
+	return err
+}
+
+// trackPartialOutput adds or removes a temporary file from the files being written.
+func trackPartialOutput(path string, writing bool) {
+	partialOutputs.Lock()
+	defer partialOutputs.Unlock()
+	if writing {
+		partialOutputs.paths[path] = true
+	} else {
+		delete(partialOutputs.paths, path)
+	}
+}
+
+// RemovePartialOutputs deletes the temporary files of any outputs still being written. It's meant to be
+// called right before the process exits without waiting for the jobs writing them.
+func RemovePartialOutputs() {
+	partialOutputs.Lock()
+	defer partialOutputs.Unlock()
+	for path := range partialOutputs.paths {
+		os.Remove(path)
+		delete(partialOutputs.paths, path)
+	}
+}
@@ -0,0 +1,86 @@
+package compressionprocess
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	s "strings"
+)
+
+// PathRoots stores the directories that relative paths in a CSV are resolved against. When a root
+// is empty, relative paths are resolved against the CSV's directory and may point anywhere. When it
+// is set, every path has to stay inside it.
+type PathRoots struct {
+	InputRoot  string
+	OutputRoot string
+}
+
+// resolveInputPath resolves an input path from a CSV in dir.
+func (roots PathRoots) resolveInputPath(path, dir string) (string, error) {
+	resolvedPath, err := resolvePath(path, roots.InputRoot, dir)
+	if err != nil {
+		return resolvedPath, errors.New("Input " + err.Error())
+	}
+	return resolvedPath, nil
+}
+
+// resolveOutputPath resolves an output path from a CSV in dir for the input at inputPath, which has already
+// been resolved. The {dir} template field is expanded to the input's directory first, so an output written next
+// to its input still has to stay inside the output root. The other fields are left for expandOutputPath.
+func (roots PathRoots) resolveOutputPath(path, inputPath, dir string) (string, error) {
+	if s.Contains(path, "{dir}") {
+		inputDir, err := filepath.Abs(filepath.Dir(inputPath))
+		if err != nil {
+			return path, err
+		}
+		path = s.ReplaceAll(path, "{dir}", inputDir)
+	}
+	resolvedPath, err := resolvePath(path, roots.OutputRoot, dir)
+	if err != nil {
+		return resolvedPath, errors.New("Output " + err.Error())
+	}
+	return resolvedPath, nil
+}
+
+// resolvePath expands a leading ~ to the home directory and joins relative paths onto the root, or
+// onto defaultDir if there's no root. Absolute paths are kept as they are. If there is a root, the
+// resolved path has to be inside it.
+func resolvePath(path, root, defaultDir string) (string, error) {
+	path, err := ExpandHome(path)
+	if err != nil {
+		return path, err
+	}
+	if root == "" {
+		if filepath.IsAbs(path) {
+			return filepath.Clean(path), nil
+		}
+		return filepath.Join(defaultDir, path), nil
+	}
+
+	root, err = ExpandHome(root)
+	if err != nil {
+		return path, err
+	}
+	root, _ = filepath.Abs(root)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+	relativePath, err := filepath.Rel(root, path)
+	if err != nil || relativePath == ".." || s.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return path, errors.New(path + " is outside of the allowed root " + root)
+	}
+	return path, nil
+}
+
+// ExpandHome replaces a leading ~ in a path with the user's home directory.
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !s.HasPrefix(path, "~/") && !s.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path, err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
@@ -0,0 +1,58 @@
+package compressionprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// PrintReport prints how many jobs in a batch succeeded, the statistics of those that asked for them and why
+// each of the others failed.
+func PrintReport(results []JobResult) {
+	var failed []JobResult
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	fmt.Printf("Compressed %d of %d images\n", len(results)-len(failed), len(results))
+	printStats(results)
+	if len(failed) == 0 {
+		return
+	}
+	fmt.Println("Failed:")
+	for _, result := range failed {
+		fmt.Printf("\t%s - %s\n", result.Job.InputPath, describeError(result.Err))
+	}
+}
+
+// describeError explains why a job failed, giving jobs that never finished because the batch was
+// stopped a clearer reason than the context's error.
+func describeError(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return "Cancelled"
+	}
+	return err.Error()
+}
+
+// printStats prints the statistics of every job that has them, most energy removed first, so the carves most likely
+// to have cut through something are at the top.
+func printStats(results []JobResult) {
+	var withStats []JobResult
+	for _, result := range results {
+		if result.Stats != nil {
+			withStats = append(withStats, result)
+		}
+	}
+	if len(withStats) == 0 {
+		return
+	}
+	sort.SliceStable(withStats, func(i, j int) bool {
+		return withStats[i].Stats.EnergyRemovedFraction > withStats[j].Stats.EnergyRemovedFraction
+	})
+	fmt.Println("Statistics:")
+	for _, result := range withStats {
+		fmt.Printf("\t%s - %s\n", result.Job.InputPath, result.Stats)
+	}
+}
@@ -0,0 +1,152 @@
+package compressionprocess
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sync"
+	"time"
+)
+
+// minPixelsPerThread is roughly the smallest share of an image worth giving to a thread. Below this,
+// the per row synchronisation in the concurrent engine costs more than the extra thread saves, so
+// the thread is better spent on another image.
+const minPixelsPerThread = 256 * 256
+
+// jobScheduler shares a fixed number of threads and, if maxMemory isn't 0, a memory budget between the
+// images being compressed at the same time.
+type jobScheduler struct {
+	numberOfThreads int
+	freeThreads     int
+	maxMemory       int64
+	usedMemory      int64
+	lock            sync.Mutex
+	resourcesFreed  *sync.Cond
+	jobsRunning     sync.WaitGroup
+}
+
+// newJobScheduler creates a jobScheduler with all of its threads and memory free.
+func newJobScheduler(numberOfThreads int, maxMemory int64) *jobScheduler {
+	scheduler := jobScheduler{numberOfThreads: numberOfThreads, freeThreads: numberOfThreads, maxMemory: maxMemory}
+	scheduler.resourcesFreed = sync.NewCond(&scheduler.lock)
+	return &scheduler
+}
+
+// chooseThreads decides how many threads an image should get. Large images get a fair share of the
+// threads between the jobs that are left so they can be split up inside the image, while small
+// images get a single thread so several of them can be compressed at once. If the job has a thread
+// profile, it decides how much of the fair share is worth using instead of minPixelsPerThread.
+func (scheduler *jobScheduler) chooseThreads(job CompressionJob, jobsLeft int) int {
+	// The low memory path only runs on one thread.
+	if job.LowMemory {
+		return 1
+	}
+	// Only the header is needed to get the size.
+	config, err := readImageConfig(job.InputPath)
+	if err != nil {
+		return 1
+	}
+
+	if jobsLeft > scheduler.numberOfThreads {
+		jobsLeft = scheduler.numberOfThreads
+	}
+	threads := scheduler.numberOfThreads / jobsLeft
+	if job.ThreadProfile != nil {
+		return chooseProfiledThreads(job, config, threads)
+	}
+	if useful := config.Width * config.Height / minPixelsPerThread; useful < threads {
+		threads = useful
+	}
+	if threads < 1 {
+		threads = 1
+	}
+	return threads
+}
+
+// chooseProfiledThreads picks the number of threads, up to the fair share, that the job's thread profile
+// predicts will compress the image the fastest and logs the choice.
+func chooseProfiledThreads(job CompressionJob, config image.Config, fairShare int) int {
+	threads, seamTime, sequentialTime := job.ThreadProfile.BestThreads(config.Width*config.Height, fairShare)
+	seamTime, sequentialTime = seamTime.Round(time.Microsecond), sequentialTime.Round(time.Microsecond)
+	if threads == 1 {
+		fmt.Printf("Auto: %s is %dx%d, compressing sequentially (about %v a seam)\n", job.InputPath, config.Width, config.Height, seamTime)
+	} else {
+		fmt.Printf("Auto: %s is %dx%d, compressing with %d threads (about %v a seam, %v on one thread)\n",
+			job.InputPath, config.Width, config.Height, threads, seamTime, sequentialTime)
+	}
+	return threads
+}
+
+// acquireThreads waits until at least one thread is free and takes up to the number wanted. Taking
+// fewer than wanted keeps every thread busy instead of waiting for a large image's full share.
+func (scheduler *jobScheduler) acquireThreads(wanted int) int {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+	for scheduler.freeThreads == 0 {
+		scheduler.resourcesFreed.Wait()
+	}
+	if wanted > scheduler.freeThreads {
+		wanted = scheduler.freeThreads
+	}
+	scheduler.freeThreads -= wanted
+	return wanted
+}
+
+// acquireMemory waits until the memory a job needs fits in the budget alongside the jobs already running
+// and takes it. A job is always let in when nothing else is running.
+func (scheduler *jobScheduler) acquireMemory(bytes int64) {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+	for scheduler.usedMemory > 0 && scheduler.usedMemory+bytes > scheduler.maxMemory {
+		scheduler.resourcesFreed.Wait()
+	}
+	scheduler.usedMemory += bytes
+}
+
+// release gives threads and memory back once an image is done.
+func (scheduler *jobScheduler) release(threads int, memory int64) {
+	scheduler.lock.Lock()
+	scheduler.freeThreads += threads
+	scheduler.usedMemory -= memory
+	scheduler.lock.Unlock()
+	scheduler.resourcesFreed.Broadcast()
+}
+
+// runJob compresses an image with the given number of threads and reports the result.
+func (scheduler *jobScheduler) runJob(ctx context.Context, job CompressionJob, threads int, memory int64, results chan<- JobResult) {
+	defer scheduler.jobsRunning.Done()
+	stats, err := compressJob(ctx, job, threads)
+	scheduler.release(threads, memory)
+	if results != nil {
+		results <- JobResult{Job: job, Err: err, Stats: stats}
+	}
+}
+
+// PoolExecutor shares a number of threads between several images at once or between the parts of one image,
+// depending on the size of the image and the number of jobs waiting. If MaxMemory isn't 0, images are only
+// started once their estimated memory fits in it (see planMemory).
+type PoolExecutor struct {
+	Threads   int
+	MaxMemory int64
+}
+
+// Run compresses images as they arrive until the jobs channel is closed.
+func (executor PoolExecutor) Run(ctx context.Context, jobs <-chan CompressionJob, results chan<- JobResult) {
+	scheduler := newJobScheduler(executor.Threads, executor.MaxMemory)
+	for job := range jobs {
+		if err := ctx.Err(); err != nil {
+			if results != nil {
+				results <- JobResult{Job: job, Err: err}
+			}
+			continue
+		}
+		job, memory := planMemory(job, executor.MaxMemory)
+		scheduler.acquireMemory(memory)
+		// The job that was just received is left too.
+		threads := scheduler.acquireThreads(scheduler.chooseThreads(job, len(jobs)+1))
+		fmt.Println("Compressing", job.InputPath, "with", threads, "threads")
+		scheduler.jobsRunning.Add(1)
+		go scheduler.runJob(ctx, job, threads, memory, results)
+	}
+	scheduler.jobsRunning.Wait()
+}
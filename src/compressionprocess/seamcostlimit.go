@@ -0,0 +1,45 @@
+package compressionprocess
+
+import (
+	"errors"
+	ic "imagecontainer"
+	"strconv"
+	s "strings"
+)
+
+// minimumLimitedSize is the smallest an image with a seam cost limit is carved to in either direction.
+const minimumLimitedSize = 3
+
+// SeamCostLimit carves an image until the next seam would cost more than Limit instead of to a fixed size, such as to
+// trim the empty space out of screenshots and banners. If Percentile is set, Limit is a percentile of the original
+// image's energy and a seam is too costly once its mean magnitude, its cost divided by its length, is above that
+// percentile. A job's rates become the smallest size the image can be carved to.
+type SeamCostLimit struct {
+	Limit      float64
+	Percentile bool
+}
+
+// ParseSeamCostLimit converts a seam cost such as 2500, or a percentile of the original energy such as p40, into a
+// SeamCostLimit.
+func ParseSeamCostLimit(limit string) (*SeamCostLimit, error) {
+	value, isPercentile := s.CutPrefix(s.ToLower(limit), "p")
+	cost, err := strconv.ParseFloat(value, 64)
+	if err != nil || cost < 0 || (isPercentile && cost > 100) {
+		return nil, errors.New("Invalid seam cost limit: " + limit)
+	}
+	return &SeamCostLimit{Limit: cost, Percentile: isPercentile}, nil
+}
+
+// SeamLimit works out the limit on an image's seams. The energy of the original image, from its Energy, is only
+// needed for a percentile.
+func (limit SeamCostLimit) SeamLimit(energy []float32) ic.SeamLimit {
+	if !limit.Percentile {
+		return ic.SeamLimit{Cost: float32(limit.Limit)}
+	}
+	return ic.SeamLimit{Cost: energyPercentile(energy, limit.Limit), PerPixel: true}
+}
+
+// LimitedSize returns the smallest size an image with a seam cost limit is carved to, from the size its rates give.
+func LimitedSize(targetX, targetY int) (int, int) {
+	return max(targetX, minimumLimitedSize), max(targetY, minimumLimitedSize)
+}
@@ -0,0 +1,86 @@
+package compressionprocess
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	ic "imagecontainer"
+	"io"
+	"os"
+	"path/filepath"
+	s "strings"
+)
+
+// SeamFile is the JSON written next to an output when its seams are recorded: the size of the original image
+// and every seam removed from it, in the order they were removed.
+type SeamFile struct {
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Seams  []SeamRecord `json:"seams"`
+}
+
+// SeamRecord is a seam in a SeamFile. The direction is vertical or horizontal, the cost is the sum of the
+// magnitudes along the seam and each point is an [x, y] pair in the original image.
+type SeamRecord struct {
+	Direction string   `json:"direction"`
+	Cost      float32  `json:"cost"`
+	Points    [][2]int `json:"points"`
+}
+
+// NewSeamFile converts the seams removed from an image of the size into a SeamFile.
+func NewSeamFile(width, height int, seams []ic.Seam) SeamFile {
+	seamFile := SeamFile{Width: width, Height: height, Seams: make([]SeamRecord, len(seams))}
+	for i, seam := range seams {
+		record := SeamRecord{Direction: "horizontal", Cost: seam.Cost, Points: make([][2]int, len(seam.Points))}
+		if seam.Vertical {
+			record.Direction = "vertical"
+		}
+		for j, point := range seam.Points {
+			record.Points[j] = [2]int{point.X, point.Y}
+		}
+		seamFile.Seams[i] = record
+	}
+	return seamFile
+}
+
+// ReadSeamFile reads a SeamFile written with --seams.
+func ReadSeamFile(path string) (SeamFile, error) {
+	var seamFile SeamFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return seamFile, err
+	}
+	if err := json.Unmarshal(data, &seamFile); err != nil {
+		return seamFile, fmt.Errorf("Invalid seam file %s: %v", path, err)
+	}
+	return seamFile, nil
+}
+
+// ImageSeams converts the seams in the file back into the seams removed from the image.
+func (seamFile SeamFile) ImageSeams() ([]ic.Seam, error) {
+	seams := make([]ic.Seam, len(seamFile.Seams))
+	for i, record := range seamFile.Seams {
+		if record.Direction != "vertical" && record.Direction != "horizontal" {
+			return nil, fmt.Errorf("Seam %d has an unknown direction: %s", i+1, record.Direction)
+		}
+		seam := ic.Seam{Vertical: record.Direction == "vertical", Cost: record.Cost, Points: make([]image.Point, len(record.Points))}
+		for j, point := range record.Points {
+			seam.Points[j] = image.Pt(point[0], point[1])
+		}
+		seams[i] = seam
+	}
+	return seams, nil
+}
+
+// SeamFilePath returns where the seams of an output are written: next to it with the extension .seams.json.
+func SeamFilePath(outputPath string) string {
+	return s.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".seams.json"
+}
+
+// writeSeamFile writes the seams as JSON, replacing any seams written for an earlier output with the same name.
+func writeSeamFile(path string, seamFile SeamFile) error {
+	_, err := writeFileAtomically(path, func(file io.Writer) error {
+		return json.NewEncoder(file).Encode(seamFile)
+	}, Overwrite)
+	return err
+}
@@ -0,0 +1,98 @@
+package compressionprocess
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	ic "imagecontainer"
+	"path/filepath"
+	s "strings"
+)
+
+// OverlayStyle decides whether an overlay of the removed seams is written next to each output and how.
+type OverlayStyle int
+
+// Constants for overlay styles
+const (
+	NoOverlay OverlayStyle = iota
+	// SolidOverlay draws every seam in its direction's color.
+	SolidOverlay
+	// ShadedOverlay draws seams removed later darker, so the order they were removed in shows.
+	ShadedOverlay
+)
+
+// The colors seams are drawn in.
+var (
+	verticalSeamColor   = color.RGBA{R: 255, A: 255}
+	horizontalSeamColor = color.RGBA{G: 96, B: 255, A: 255}
+)
+
+// ParseOverlayStyle converts solid or shaded into an OverlayStyle.
+func ParseOverlayStyle(name string) (OverlayStyle, error) {
+	switch s.ToLower(name) {
+	case "solid":
+		return SolidOverlay, nil
+	case "shaded":
+		return ShadedOverlay, nil
+	}
+	return NoOverlay, errors.New("Unknown overlay style: " + name)
+}
+
+// OverlayPath returns where the overlay of an output is written: next to it with the extension .overlay.png.
+func OverlayPath(outputPath string) string {
+	return s.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".overlay.png"
+}
+
+// DrawSeams returns a copy of the original image with every seam removed from it drawn on top, vertical seams in
+// red and horizontal seams in blue. In the shaded style, each seam is darker than the one removed before it.
+func DrawSeams(original image.Image, seams []ic.Seam, style OverlayStyle) *image.RGBA {
+	bounds := original.Bounds()
+	overlay := image.NewRGBA(bounds)
+	draw.Draw(overlay, bounds, original, bounds.Min, draw.Src)
+	for order, seam := range seams {
+		seamColor := horizontalSeamColor
+		if seam.Vertical {
+			seamColor = verticalSeamColor
+		}
+		if style == ShadedOverlay {
+			seamColor = shade(seamColor, 1-.75*float64(order)/float64(len(seams)))
+		}
+		for _, point := range seam.Points {
+			overlay.SetRGBA(point.X, point.Y, seamColor)
+		}
+	}
+	return overlay
+}
+
+// shade scales the color's brightness, leaving it opaque.
+func shade(seamColor color.RGBA, brightness float64) color.RGBA {
+	return color.RGBA{
+		R: uint8(float64(seamColor.R) * brightness),
+		G: uint8(float64(seamColor.G) * brightness),
+		B: uint8(float64(seamColor.B) * brightness),
+		A: 255}
+}
+
+// writeSeamOutputs writes the seam file and the overlay asked for by the job next to its output, replacing any
+// written for an earlier output with the same name. The original image has to be read again for jobs on the low
+// memory path, since they carve the decoded image in place.
+func writeSeamOutputs(job CompressionJob, outputPath string, original image.Image, seams []ic.Seam) error {
+	bounds := original.Bounds()
+	if job.RecordSeams {
+		if err := writeSeamFile(SeamFilePath(outputPath), NewSeamFile(bounds.Dx(), bounds.Dy(), seams)); err != nil {
+			return err
+		}
+	}
+	if job.Overlay == NoOverlay {
+		return nil
+	}
+	if job.LowMemory {
+		var err error
+		if original, err = getImageForFiltering(job.InputPath); err != nil {
+			return err
+		}
+	}
+	_, err := writeImageAtomically(OverlayPath(outputPath), DrawSeams(original, seams, job.Overlay), Overwrite)
+	return err
+}
@@ -0,0 +1,102 @@
+package compressionprocess
+
+import (
+	ic "imagecontainer"
+)
+
+// imageProcessContext stores the image being compressed, what runs each stage of removing a seam from it and
+// what saves the debug output of its seams, if any.
+type imageProcessContext struct {
+	imageToProcess *ic.ImageToProcess
+	stages         stageRunner
+	debug          *debugRecorder
+}
+
+// runSections processes the bounds returned by sectionBounds for each part of [min, max).
+func (ctx *imageProcessContext) runSections(min, max int, sectionBounds func(min, max int) ic.CompressionBounds) {
+	ctx.stages.runSections(min, max, func(start, end int) {
+		ctx.imageToProcess.ProcessInstruction(sectionBounds(start, end))
+	})
+}
+
+// removeVerticalSeam identifies a vertcal seam in the image with the minmial gradient magnitude and then removes
+// it, leaving the image one column narrower. A seam over the image's seam limit is left in and stops its direction.
+func (ctx *imageProcessContext) removeVerticalSeam() {
+	width, height := ctx.imageToProcess.Width(), ctx.imageToProcess.Height()
+	LastRowBounds := ic.CompressionBounds{MinY: height - 1, MaxX: width - 1, MaxY: height - 1}
+	saveDebug := ctx.debug.nextSeam()
+
+	// Create gradient magnitude matrix
+	ctx.runSections(0, width, func(minX, maxX int) ic.CompressionBounds {
+		return ic.CompressionBounds{MinX: minX, MaxX: maxX - 1, MinY: 0, MaxY: height - 1, Instruction: ic.IPixelMagnitude}
+	})
+	// The energy is kept until the seam is known to be removed, since the seam search overwrites it.
+	var energy [][]float32
+	if saveDebug {
+		energy = magnitudeRows(ctx.imageToProcess, true)
+	}
+
+	// Find lowest magnitude vertical paths, a band of rows at a time.
+	ctx.stages.runWavefront(1, height, width, func(y, minX, maxX int) {
+		ctx.imageToProcess.MinimzeVerticalSeam(ic.CompressionBounds{MinX: minX, MaxX: maxX - 1, MinY: y, MaxY: y + 1})
+	})
+
+	// Single threaded, mark pixels to remove.
+	minX, minY := ctx.imageToProcess.FindMinSeam(LastRowBounds)
+	if ctx.imageToProcess.ReachedSeamLimit(true, minX, minY) {
+		return
+	}
+	ctx.debug.countSeam()
+	if saveDebug {
+		ctx.debug.save(energy, true, "energy")
+		ctx.debug.save(magnitudeRows(ctx.imageToProcess, false), true, "cost")
+	}
+	ctx.imageToProcess.MarkVerticalSeam(minX, minY)
+
+	// Shift each row over the seam.
+	ctx.runSections(0, height, func(minY, maxY int) ic.CompressionBounds {
+		return ic.CompressionBounds{MinX: 0, MaxX: width, MinY: minY, MaxY: maxY, Instruction: ic.IRemoveColumn}
+	})
+	ctx.imageToProcess.DropLastColumn()
+}
+
+// removeHorizontalSeam identifies a horizontal seam in the image with the minmial gradient magnitude and then removes
+// it, leaving the image one row shorter. A seam over the image's seam limit is left in and stops its direction.
+func (ctx *imageProcessContext) removeHorizontalSeam() {
+	width, height := ctx.imageToProcess.Width(), ctx.imageToProcess.Height()
+	LastColumnBounds := ic.CompressionBounds{MinX: width - 1, MaxX: width - 1, MinY: 0, MaxY: height - 1}
+	saveDebug := ctx.debug.nextSeam()
+
+	// Create gradient magnitude matrix
+	ctx.runSections(0, width, func(minX, maxX int) ic.CompressionBounds {
+		return ic.CompressionBounds{MinX: minX, MaxX: maxX - 1, MinY: 0, MaxY: height - 1, Instruction: ic.IPixelMagnitude}
+	})
+	// The energy is kept until the seam is known to be removed, since the seam search overwrites it.
+	var energy [][]float32
+	if saveDebug {
+		energy = magnitudeRows(ctx.imageToProcess, true)
+	}
+
+	// Find lowest magnitude horizontal paths, a band of columns at a time.
+	ctx.stages.runWavefront(1, width, height, func(x, minY, maxY int) {
+		ctx.imageToProcess.MinimzeHorizontalSeam(ic.CompressionBounds{MinX: x, MaxX: x + 1, MinY: minY, MaxY: maxY - 1})
+	})
+
+	// Single threaded, mark pixels to remove
+	minX, minY := ctx.imageToProcess.FindMinSeam(LastColumnBounds)
+	if ctx.imageToProcess.ReachedSeamLimit(false, minX, minY) {
+		return
+	}
+	ctx.debug.countSeam()
+	if saveDebug {
+		ctx.debug.save(energy, false, "energy")
+		ctx.debug.save(magnitudeRows(ctx.imageToProcess, false), false, "cost")
+	}
+	ctx.imageToProcess.MarkHorizontalSeam(minX, minY)
+
+	// Shift each column over the seam.
+	ctx.runSections(0, width, func(minX, maxX int) ic.CompressionBounds {
+		return ic.CompressionBounds{MinX: minX, MaxX: maxX, MinY: 0, MaxY: height, Instruction: ic.IRemoveRow}
+	})
+	ctx.imageToProcess.DropLastRow()
+}
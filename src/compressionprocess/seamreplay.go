@@ -0,0 +1,46 @@
+package compressionprocess
+
+import (
+	"context"
+	"fmt"
+	ic "imagecontainer"
+)
+
+// ReplaySeams removes the seams from the image in order, so it ends up aligned with the image they were
+// recorded from. If the context is done first, it stops at the next seam and returns the context's error.
+func ReplaySeams(ctx context.Context, imageToProcess *ic.ImageToProcess, seams []ic.Seam) error {
+	for i, seam := range seams {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := imageToProcess.ReplaySeam(seam); err != nil {
+			return fmt.Errorf("Seam %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// ReplaySeamFile removes the seams in a SeamFile from the image at the input path and writes the result to the
+// output path, so auxiliary layers such as masks or depth maps are carved exactly like the image the seams were
+// recorded from. The input has to be the same size as that image.
+func ReplaySeamFile(ctx context.Context, seamFile SeamFile, inputPath, outputPath string, policy CollisionPolicy) error {
+	seams, err := seamFile.ImageSeams()
+	if err != nil {
+		return err
+	}
+	currentImage, err := getImageForFiltering(inputPath)
+	if err != nil {
+		return err
+	}
+	bounds := currentImage.Bounds()
+	if bounds.Dx() != seamFile.Width || bounds.Dy() != seamFile.Height {
+		return fmt.Errorf("The image is %dx%d but the seams were recorded from a %dx%d image", bounds.Dx(), bounds.Dy(), seamFile.Width, seamFile.Height)
+	}
+
+	imageToProcess := ic.NewImageToProcess(outputPath, currentImage, bounds.Dx(), bounds.Dy())
+	if err := ReplaySeams(ctx, imageToProcess, seams); err != nil {
+		return err
+	}
+	_, err = writeImageAtomically(outputPath, imageToProcess.OutputImage(), policy)
+	return err
+}
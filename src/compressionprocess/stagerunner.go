@@ -0,0 +1,40 @@
+package compressionprocess
+
+// stageRunner runs the stages of removing a seam. Every stage covers a range of columns or rows and the
+// runner decides how the range is split up, so each cell is processed the same way whichever runner is used.
+type stageRunner interface {
+	// runSections calls process over parts [start, end) of [min, max) and returns once they are all done.
+	runSections(min, max int, process func(start, end int))
+	// runWavefront calls minimize for every step in [firstStep, lastStep) over the cells [0, length), with
+	// every cell minimized after the cells it depends on in the step before it.
+	runWavefront(firstStep, lastStep, length int, minimize func(step, start, end int))
+	close()
+}
+
+// serialStages runs every stage on the calling thread.
+type serialStages struct{}
+
+// newStageRunner returns a pool of workers for more than one thread and serialStages otherwise.
+func newStageRunner(numberOfThreads int) stageRunner {
+	if numberOfThreads > 1 {
+		return newWorkerPool(numberOfThreads)
+	}
+	return serialStages{}
+}
+
+// runSections processes the whole range at once.
+func (serialStages) runSections(min, max int, process func(start, end int)) {
+	if min < max {
+		process(min, max)
+	}
+}
+
+// runWavefront minimizes a step at a time.
+func (serialStages) runWavefront(firstStep, lastStep, length int, minimize func(step, start, end int)) {
+	for step := firstStep; step < lastStep; step++ {
+		minimize(step, 0, length)
+	}
+}
+
+// close does nothing, there are no workers to stop.
+func (serialStages) close() {}
@@ -0,0 +1,213 @@
+package compressionprocess
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	ic "imagecontainer"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ValidateManifest checks every line of a CSV without compressing anything. It reads the header of each
+// input image, works out the target dimensions and output path and makes sure the output can be written.
+// It then prints the number of seams that will be removed and a rough estimate of how long it will take
+// to run sequentially. It returns the number of lines with problems.
+func ValidateManifest(fileName string, roots PathRoots, collision CollisionPolicy) (int, error) {
+	path, _ := filepath.Abs(fileName)
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	dir := filepath.Dir(path)
+
+	reader := bufio.NewReader(file)
+	problems, totalSeams, batchStopped := 0, 0, false
+	var totalPixelVisits float64
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return problems, err
+		}
+		// A trailing new line at the end of the file isn't a problem.
+		if err == io.EOF && line == "" {
+			break
+		}
+
+		lineValues, parseErr := splitLine(line)
+		if parseErr == nil && (lineValues[0] == "" || lineValues[1] == "") {
+			parseErr = errors.New("Missing Input Or Output Path")
+		}
+		if parseErr != nil {
+			problems++
+			fmt.Printf("Line %d: %v\n", lineNumber, parseErr)
+			// The launchers stop reading at the first bad line, so the rest of the file would be ignored.
+			if !batchStopped {
+				fmt.Printf("Line %d: The batch will stop here.\n", lineNumber)
+				batchStopped = true
+			}
+		} else if job, pathErr := newManifestJob(dir, lineValues, roots); pathErr != nil {
+			problems++
+			fmt.Printf("Line %d: %v\n", lineNumber, pathErr)
+		} else {
+			job.Collision = collision
+			seams, pixelVisits, jobErr := validateJob(job)
+			if jobErr != nil {
+				problems++
+				fmt.Printf("Line %d: %s - %v\n", lineNumber, job.InputPath, jobErr)
+			} else {
+				totalSeams += seams
+				totalPixelVisits += pixelVisits
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	estimate := time.Duration(totalPixelVisits * estimateNanosPerPixel())
+	fmt.Println("Lines with problems:", problems)
+	fmt.Println("Seams to remove:", totalSeams)
+	fmt.Println("Estimated sequential runtime:", estimate.Round(time.Millisecond))
+	return problems, nil
+}
+
+// validateJob checks a single job and returns the number of seams it will remove and the number of
+// pixels that will be visited while removing them.
+func validateJob(job CompressionJob) (seams int, pixelVisits float64, err error) {
+	file, err := os.Open(job.InputPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Only the header is read.
+	config, format, err := image.DecodeConfig(file)
+	file.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+	if format != "png" {
+		return 0, 0, errors.New("Not A PNG: " + format)
+	}
+
+	imageBounds := image.Rect(0, 0, config.Width, config.Height)
+	targetX, targetY, err := getTargetDimensions(job.InputPath, job.ScaleRateX, job.ScaleRateY, imageBounds)
+	if err != nil {
+		return 0, 0, err
+	}
+	if targetX, targetY, err = smallestTarget(job, targetX, targetY); err != nil {
+		return 0, 0, err
+	}
+	outputPath, layerPaths, skip, err := resolveJobOutputPaths(job, targetX, targetY)
+	if err != nil {
+		return 0, 0, err
+	}
+	if skip {
+		fmt.Println("Output exists and will be skipped:", outputPath)
+		return 0, 0, nil
+	}
+	if err = checkWritable(outputPath); err != nil {
+		return 0, 0, err
+	}
+	if err = validateLayers(job, config, layerPaths, targetX, targetY); err != nil {
+		return 0, 0, err
+	}
+
+	// Follow the same order as the compression loop, a horizontal seam then a vertical seam.
+	width, height := config.Width, config.Height
+	for targetY < height || targetX < width {
+		if targetY < height {
+			pixelVisits += float64(width * height)
+			height--
+			seams++
+		}
+		if targetX < width {
+			pixelVisits += float64(width * height)
+			width--
+			seams++
+		}
+	}
+	fmt.Printf("%s: %dx%d -> %dx%d, %d seams -> %s\n", job.InputPath, config.Width, config.Height, targetX, targetY, seams, outputPath)
+	return seams, pixelVisits, nil
+}
+
+// validateLayers checks that each of the job's layers is a png the same size as the job's image and that
+// its output, resolved with the job's (see resolveJobOutputPaths), can be written.
+func validateLayers(job CompressionJob, config image.Config, layerPaths []string, targetX, targetY int) error {
+	for i, layer := range job.Layers {
+		layerConfig, err := readImageConfig(layer.InputPath)
+		if err != nil {
+			return fmt.Errorf("%s - %w", layer.InputPath, err)
+		}
+		if layerConfig.Width != config.Width || layerConfig.Height != config.Height {
+			return fmt.Errorf("%s - %w", layer.InputPath, ic.ErrLayerSize)
+		}
+		if layerPaths[i] == "" {
+			layerJob := job
+			layerJob.InputPath, layerJob.OutputPath = layer.InputPath, layer.OutputPath
+			outputPath, _ := expandOutputPath(layerJob, targetX, targetY)
+			fmt.Println("Layer output exists and will be skipped:", outputPath)
+		} else if err = checkWritable(layerPaths[i]); err != nil {
+			return fmt.Errorf("%s - %w", layer.InputPath, err)
+		}
+	}
+	return nil
+}
+
+// checkWritable makes sure the output's directory exists, or can be created, and accepts new files.
+func checkWritable(outputPath string) error {
+	if info, err := os.Stat(outputPath); err == nil && info.IsDir() {
+		return errors.New(outputPath + " is a directory")
+	}
+	// Find the closest directory that already exists.
+	dir := filepath.Dir(outputPath)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return errors.New(dir + " is not a directory")
+			}
+			break
+		}
+		if !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+			return err
+		}
+		dir = filepath.Dir(dir)
+	}
+	testFile, err := os.CreateTemp(dir, ".validate*")
+	if err != nil {
+		return err
+	}
+	testFile.Close()
+	return os.Remove(testFile.Name())
+}
+
+// estimateNanosPerPixel times the removal of a few seams from a small generated image to estimate
+// how long each pixel visited takes on this machine.
+func estimateNanosPerPixel() float64 {
+	width, height, seams := 128, 128, 8
+	var pixelVisits float64
+	imageToProcess := ic.NewImageToProcess("", generateImage(width, height), width-seams, height)
+	ctx := imageProcessContext{imageToProcess: imageToProcess, stages: serialStages{}}
+	start := time.Now()
+	for seam := 0; seam < seams; seam++ {
+		pixelVisits += float64(imageToProcess.Width() * imageToProcess.Height())
+		ctx.removeVerticalSeam()
+	}
+	return float64(time.Since(start).Nanoseconds()) / pixelVisits
+}
+
+// generateImage creates an image with enough detail to time the compression on.
+func generateImage(width, height int) *image.RGBA {
+	generatedImage := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			generatedImage.Set(x, y, color.RGBA{uint8(x * y), uint8(x), uint8(y), 255})
+		}
+	}
+	return generatedImage
+}
@@ -0,0 +1,299 @@
+package compressionprocess
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	s "strings"
+	"sync"
+	"time"
+)
+
+// WatchRule stores the scale rates for images dropped into a folder of the watched directory.
+type WatchRule struct {
+	Folder     string
+	ScaleRateX string
+	ScaleRateY string
+}
+
+// WatchOptions stores the directories and rules used by WatchFolder.
+type WatchOptions struct {
+	DropDir    string
+	OutputDir  string
+	DoneDir    string
+	FailedDir  string
+	Rules      []WatchRule
+	Extensions []string
+	Interval   time.Duration
+	Executor   Executor
+	Timeout    time.Duration
+
+	NameTemplate  string
+	Collision     CollisionPolicy
+	ThreadProfile *ThreadProfile
+	RecordSeams   bool
+	Overlay       OverlayStyle
+	Debug         *DebugOptions
+	Stats         bool
+	SeamCostLimit *SeamCostLimit
+}
+
+// fileState is what a file looked like the last time the drop directory was polled.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// folderWatcher tracks the files in the drop directory and which of them are being compressed.
+type folderWatcher struct {
+	opts       WatchOptions
+	lastSeen   map[string]fileState
+	inProgress map[string]bool
+	lock       sync.Mutex
+}
+
+// ReadWatchRules reads a CSV of rules with the columns: folder (relative to the drop directory), rate to
+// compress x and rate to compress y. Use . as the folder for a rule that applies to the whole drop directory.
+// Empty lines and lines starting with # are ignored.
+func ReadWatchRules(fileName string) ([]WatchRule, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []WatchRule
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = s.TrimSpace(line)
+		if line != "" && !s.HasPrefix(line, "#") {
+			lineData := s.Split(line, ",")
+			if len(lineData) < 3 {
+				return nil, errors.New("Missing Desired Dimensions " + line)
+			}
+			rules = append(rules, WatchRule{
+				Folder:     filepath.Clean(s.TrimSpace(lineData[0])),
+				ScaleRateX: s.TrimSpace(lineData[1]),
+				ScaleRateY: s.TrimSpace(lineData[2])})
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("No rules in " + fileName)
+	}
+	return rules, nil
+}
+
+// WatchFolder polls the drop directory for new images and compresses each one according to the rule for
+// the folder it was dropped in, as soon as it has finished being written. The output mirrors the image's path
+// inside the output directory and the original is moved into the done or failed directory. It runs until
+// the context is done, leaving any image it didn't finish in the drop directory, or until the drop directory
+// can no longer be read.
+func WatchFolder(ctx context.Context, opts WatchOptions) error {
+	if opts.Interval <= 0 {
+		opts.Interval = 2 * time.Second
+	}
+	watcher := folderWatcher{
+		opts:       opts,
+		lastSeen:   make(map[string]fileState),
+		inProgress: make(map[string]bool)}
+
+	// The engine keeps running between polls so images are processed as they arrive.
+	jobs := make(chan CompressionJob)
+	results := make(chan JobResult)
+	go func() {
+		opts.Executor.Run(ctx, jobs, results)
+		close(results)
+	}()
+	resultsHandled := make(chan struct{})
+	go func() {
+		watcher.handleResults(results)
+		close(resultsHandled)
+	}()
+	// Wait for the jobs already queued to finish or be cancelled before returning.
+	defer func() {
+		close(jobs)
+		<-resultsHandled
+	}()
+
+	for {
+		if err := watcher.poll(jobs); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.Interval):
+		}
+	}
+}
+
+// poll walks the drop directory and queues any image whose size and modification time haven't changed
+// since the last poll.
+func (watcher *folderWatcher) poll(jobs chan<- CompressionJob) error {
+	seen := make(map[string]fileState)
+	var ready []string
+	err := filepath.Walk(watcher.opts.DropDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files can be moved out from under the walk while jobs finish.
+			if os.IsNotExist(err) && path != watcher.opts.DropDir {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path != watcher.opts.DropDir && watcher.isOutputDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !hasExtension(path, watcher.opts.Extensions) {
+			return nil
+		}
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		seen[path] = state
+		// Files that are still being copied in will change between polls.
+		if last, ok := watcher.lastSeen[path]; ok && last == state {
+			ready = append(ready, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	watcher.lastSeen = seen
+
+	for _, path := range ready {
+		watcher.lock.Lock()
+		inProgress := watcher.inProgress[path]
+		watcher.inProgress[path] = true
+		watcher.lock.Unlock()
+		if inProgress {
+			continue
+		}
+
+		relativePath, _ := filepath.Rel(watcher.opts.DropDir, path)
+		rule, err := watcher.findRule(relativePath)
+		if err != nil {
+			fmt.Println(err, path)
+			watcher.finishFile(path, err)
+			continue
+		}
+		fmt.Println("Compressing", relativePath)
+		jobs <- CompressionJob{
+			InputPath:  path,
+			OutputPath: ApplyNameTemplate(filepath.Join(watcher.opts.OutputDir, relativePath), watcher.opts.NameTemplate),
+			ScaleRateX: rule.ScaleRateX,
+			ScaleRateY: rule.ScaleRateY,
+			Collision:  watcher.opts.Collision,
+			Timeout:    watcher.opts.Timeout,
+
+			ThreadProfile: watcher.opts.ThreadProfile,
+			RecordSeams:   watcher.opts.RecordSeams,
+			Overlay:       watcher.opts.Overlay,
+			Debug:         watcher.opts.Debug,
+			Stats:         watcher.opts.Stats,
+			SeamCostLimit: watcher.opts.SeamCostLimit}
+	}
+	return nil
+}
+
+// isOutputDir checks if the directory is one the watcher writes into, or inside one, so it isn't watched. An
+// output directory that holds the whole drop directory doesn't count, since nothing is written into the drop
+// directory from it.
+func (watcher *folderWatcher) isOutputDir(path string) bool {
+	path, _ = filepath.Abs(path)
+	dropDir, _ := filepath.Abs(watcher.opts.DropDir)
+	for _, dir := range []string{watcher.opts.OutputDir, watcher.opts.DoneDir, watcher.opts.FailedDir} {
+		if dir == "" {
+			continue
+		}
+		dir, _ = filepath.Abs(dir)
+		if isWithin(path, dir) && !isWithin(dropDir, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithin checks if the absolute path is the directory or anywhere inside it.
+func isWithin(path, dir string) bool {
+	return path == dir || s.HasPrefix(path, s.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// findRule returns the rule for the deepest folder containing the image.
+func (watcher *folderWatcher) findRule(relativePath string) (WatchRule, error) {
+	var bestRule WatchRule
+	bestDepth := -1
+	for _, rule := range watcher.opts.Rules {
+		depth := 0
+		if rule.Folder != "." {
+			if !s.HasPrefix(relativePath, rule.Folder+string(filepath.Separator)) {
+				continue
+			}
+			depth = s.Count(rule.Folder, string(filepath.Separator)) + 1
+		}
+		if depth > bestDepth {
+			bestRule, bestDepth = rule, depth
+		}
+	}
+	if bestDepth < 0 {
+		return bestRule, errors.New("No rule for folder")
+	}
+	return bestRule, nil
+}
+
+// handleResults moves each original into the done or failed directory once its job is finished. Images
+// whose jobs were cancelled are left in the drop directory to be compressed next time.
+func (watcher *folderWatcher) handleResults(results <-chan JobResult) {
+	for result := range results {
+		if errors.Is(result.Err, context.Canceled) {
+			fmt.Println("Cancelled:", result.Job.InputPath)
+			watcher.lock.Lock()
+			delete(watcher.inProgress, result.Job.InputPath)
+			watcher.lock.Unlock()
+			continue
+		}
+		if result.Err != nil {
+			fmt.Println("Failed:", result.Job.InputPath, result.Err)
+		} else if result.Stats != nil {
+			fmt.Println("Finished:", result.Job.OutputPath, "-", result.Stats)
+		} else {
+			fmt.Println("Finished:", result.Job.OutputPath)
+		}
+		watcher.finishFile(result.Job.InputPath, result.Err)
+	}
+}
+
+// finishFile moves an original out of the drop directory so it isn't processed again.
+func (watcher *folderWatcher) finishFile(path string, jobErr error) {
+	destinationDir := watcher.opts.DoneDir
+	if jobErr != nil {
+		destinationDir = watcher.opts.FailedDir
+	}
+	relativePath, _ := filepath.Rel(watcher.opts.DropDir, path)
+	destination := filepath.Join(destinationDir, relativePath)
+	err := os.MkdirAll(filepath.Dir(destination), 0755)
+	if err == nil {
+		err = os.Rename(path, destination)
+	}
+	if err != nil {
+		// Leave it marked as in progress so it isn't compressed again.
+		fmt.Println("Could not move", path, "to", destinationDir, err)
+		return
+	}
+
+	watcher.lock.Lock()
+	delete(watcher.inProgress, path)
+	watcher.lock.Unlock()
+}
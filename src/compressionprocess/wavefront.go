@@ -0,0 +1,151 @@
+package compressionprocess
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// maxBandHeight is the most rows (or columns) of the seam search that are processed between synchronising
+// with neighbouring blocks.
+const maxBandHeight = 32
+
+// wavefront runs the seam search many rows at a time instead of waiting on a barrier after every row.
+// The image is split into a block of columns per worker and the rows into bands. Within a band, each
+// block first fills in a trapezoid that shrinks by a column on each side every row, because those
+// cells only depend on cells in the same block. The triangles left between neighbouring trapezoids are
+// filled in once both of those trapezoids are done. A block only waits on its neighbours, never on the
+// whole image. For horizontal seams, rows and columns are swapped.
+type wavefront struct {
+	pool           *workerPool
+	firstStep      int
+	lastStep       int
+	bandHeight     int
+	blocks         []int
+	trapezoidsDone []int32
+	trianglesDone  []int32
+	nextTask       int32
+	numberOfTasks  int32
+	minimize       func(step, start, end int)
+}
+
+// runWavefront calls minimize for every step in [firstStep, lastStep) over the cells [0, length). Every
+// cell of a step is minimized after the cells it depends on in the step before it, so the result is the
+// same as minimizing one step at a time.
+func (pool *workerPool) runWavefront(firstStep, lastStep, length int, minimize func(step, start, end int)) {
+	if firstStep >= lastStep {
+		return
+	}
+	// Each block needs to be at least two cells wide to have room for its trapezoid.
+	numberOfBlocks := pool.numberOfWorkers
+	if numberOfBlocks > length/2 {
+		numberOfBlocks = length / 2
+	}
+	if numberOfBlocks < 1 {
+		numberOfBlocks = 1
+	}
+	blocks := make([]int, numberOfBlocks+1)
+	for block := range blocks {
+		blocks[block] = block * length / numberOfBlocks
+	}
+	bandHeight := maxBandHeight
+	if numberOfBlocks > 1 && bandHeight > (length/numberOfBlocks)/2 {
+		bandHeight = (length / numberOfBlocks) / 2
+	}
+
+	numberOfBands := (lastStep - firstStep + bandHeight - 1) / bandHeight
+	front := wavefront{
+		pool:           pool,
+		firstStep:      firstStep,
+		lastStep:       lastStep,
+		bandHeight:     bandHeight,
+		blocks:         blocks,
+		trapezoidsDone: make([]int32, numberOfBlocks),
+		trianglesDone:  make([]int32, numberOfBlocks),
+		numberOfTasks:  int32(numberOfBands * (2*numberOfBlocks - 1)),
+		minimize:       minimize}
+	pool.run(func(section int) {
+		front.processTasks()
+	})
+}
+
+// processTasks claims tasks until there are none left. Each band has a trapezoid task for every block
+// followed by a triangle task for every boundary between blocks. Tasks are claimed in that order, so
+// everything a task waits on has already been claimed by a thread that is working on it.
+func (front *wavefront) processTasks() {
+	numberOfBlocks := len(front.blocks) - 1
+	tasksPerBand := 2*numberOfBlocks - 1
+	for {
+		task := int(atomic.AddInt32(&front.nextTask, 1)) - 1
+		if task >= int(front.numberOfTasks) {
+			return
+		}
+		band, block := task/tasksPerBand, task%tasksPerBand
+		if block < numberOfBlocks {
+			front.processTrapezoid(band, block)
+		} else {
+			front.processTriangle(band, block-numberOfBlocks+1)
+		}
+	}
+}
+
+// waitFor yields until the counter reaches the number of bands.
+func waitFor(counter *int32, bands int) {
+	for atomic.LoadInt32(counter) < int32(bands) {
+		runtime.Gosched()
+	}
+}
+
+// bandSteps returns the steps [start, end) in a band.
+func (front *wavefront) bandSteps(band int) (start, end int) {
+	start = front.firstStep + band*front.bandHeight
+	end = start + front.bandHeight
+	if end > front.lastStep {
+		end = front.lastStep
+	}
+	return start, end
+}
+
+// processTrapezoid minimizes the cells of a block that don't depend on its neighbours in this band.
+// It needs the block and both of the triangles on its edges from the last band.
+func (front *wavefront) processTrapezoid(band, block int) {
+	lastBlock := len(front.blocks) - 2
+	waitFor(&front.trapezoidsDone[block], band)
+	if block > 0 {
+		waitFor(&front.trianglesDone[block], band)
+	}
+	if block < lastBlock {
+		waitFor(&front.trianglesDone[block+1], band)
+	}
+
+	start, end := front.bandSteps(band)
+	for step := start; step < end; step++ {
+		// Edges of the image don't have a neighbour to wait on, so they don't shrink.
+		shrink := step - start
+		minCell, maxCell := front.blocks[block], front.blocks[block+1]
+		if block > 0 {
+			minCell += shrink
+		}
+		if block < lastBlock {
+			maxCell -= shrink
+		}
+		if minCell < maxCell {
+			front.minimize(step, minCell, maxCell)
+		}
+	}
+	atomic.AddInt32(&front.trapezoidsDone[block], 1)
+}
+
+// processTriangle minimizes the cells between the trapezoids of block-1 and block in this band once
+// both of them are done.
+func (front *wavefront) processTriangle(band, block int) {
+	waitFor(&front.trapezoidsDone[block-1], band+1)
+	waitFor(&front.trapezoidsDone[block], band+1)
+
+	start, end := front.bandSteps(band)
+	boundary := front.blocks[block]
+	for step := start + 1; step < end; step++ {
+		shrink := step - start
+		front.minimize(step, boundary-shrink, boundary+shrink)
+	}
+	atomic.AddInt32(&front.trianglesDone[block], 1)
+}
@@ -0,0 +1,58 @@
+package compressionprocess
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// searchGrid runs a seam search shaped like the real one over random costs with the runner given: every cell
+// adds its cost to the cheapest of the three cells above it. It also counts how often each cell was minimized.
+func searchGrid(runner stageRunner, width, height int, seed int64) (cumulative []float32, visits []int32) {
+	random := rand.New(rand.NewSource(seed))
+	cumulative = make([]float32, width*height)
+	for i := range cumulative {
+		cumulative[i] = float32(random.Intn(256))
+	}
+	visits = make([]int32, width*height)
+	runner.runWavefront(1, height, width, func(step, start, end int) {
+		for x := start; x < end; x++ {
+			above := cumulative[(step-1)*width+x]
+			if x > 0 && cumulative[(step-1)*width+x-1] < above {
+				above = cumulative[(step-1)*width+x-1]
+			}
+			if x < width-1 && cumulative[(step-1)*width+x+1] < above {
+				above = cumulative[(step-1)*width+x+1]
+			}
+			cumulative[step*width+x] += above
+			visits[step*width+x]++
+		}
+	})
+	return cumulative, visits
+}
+
+func TestWavefrontMatchesSerial(t *testing.T) {
+	sizes := []struct{ width, height int }{
+		{1, 1}, {1, 50}, {2, 40}, {3, 3}, {5, 100},
+		{16, 4}, {64, 31}, {64, 32}, {64, 33}, {100, 7},
+		{97, 71}, {250, 90}, {33, 200}, {512, 65},
+	}
+	for _, size := range sizes {
+		expected, _ := searchGrid(serialStages{}, size.width, size.height, int64(size.width*1000+size.height))
+		for _, threads := range []int{2, 3, 4, 7, 8, 16} {
+			t.Run(fmt.Sprintf("%dx%d p=%d", size.width, size.height, threads), func(t *testing.T) {
+				pool := newWorkerPool(threads)
+				defer pool.close()
+				cumulative, visits := searchGrid(pool, size.width, size.height, int64(size.width*1000+size.height))
+				for i := range expected {
+					if i >= size.width && visits[i] != 1 {
+						t.Fatalf("cell %d, %d minimized %d times", i%size.width, i/size.width, visits[i])
+					}
+					if cumulative[i] != expected[i] {
+						t.Fatalf("cell %d, %d is %v, serially %v", i%size.width, i/size.width, cumulative[i], expected[i])
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package compressionprocess
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// workerPool keeps the same threads alive for a whole image. Each stage of the compression is split into
+// one section per worker and run only returns once every section is done, so the stages act as barriers
+// without creating any channels. Sections are claimed rather than handed out, so a worker that is slow to
+// wake up doesn't hold up the stage. The thread calling run processes whatever is left.
+type workerPool struct {
+	numberOfWorkers int
+	currentStage    *poolStage
+	closed          bool
+	lock            sync.Mutex
+	stageReady      *sync.Cond
+}
+
+// poolStage is a single stage of work and the sections of it that have been claimed and finished.
+type poolStage struct {
+	process      func(section int)
+	nextSection  int32
+	sectionsDone sync.WaitGroup
+}
+
+// newWorkerPool launches the workers. The thread calling run also works, so only numberOfWorkers-1
+// goroutines are started.
+func newWorkerPool(numberOfWorkers int) *workerPool {
+	pool := workerPool{numberOfWorkers: numberOfWorkers}
+	pool.stageReady = sync.NewCond(&pool.lock)
+	for worker := 1; worker < numberOfWorkers; worker++ {
+		go pool.work()
+	}
+	return &pool
+}
+
+// run processes every section of the stage and waits for all of them to finish.
+func (pool *workerPool) run(process func(section int)) {
+	stage := &poolStage{process: process}
+	stage.sectionsDone.Add(pool.numberOfWorkers)
+	pool.lock.Lock()
+	pool.currentStage = stage
+	pool.lock.Unlock()
+	pool.stageReady.Broadcast()
+
+	pool.processSections(stage)
+	stage.sectionsDone.Wait()
+}
+
+// runSections splits [min, max) into a section for each worker and processes the sections at once.
+func (pool *workerPool) runSections(min, max int, process func(start, end int)) {
+	pool.run(func(section int) {
+		start, end := pool.section(min, max, section)
+		if start < end {
+			process(start, end)
+		}
+	})
+}
+
+// processSections claims and processes sections of the stage until there are none left.
+func (pool *workerPool) processSections(stage *poolStage) {
+	for {
+		section := int(atomic.AddInt32(&stage.nextSection, 1)) - 1
+		if section >= pool.numberOfWorkers {
+			return
+		}
+		stage.process(section)
+		stage.sectionsDone.Done()
+	}
+}
+
+// work waits for each new stage and helps with it until the pool is closed.
+func (pool *workerPool) work() {
+	var lastStage *poolStage
+	for {
+		pool.lock.Lock()
+		for pool.currentStage == lastStage && !pool.closed {
+			pool.stageReady.Wait()
+		}
+		if pool.closed {
+			pool.lock.Unlock()
+			return
+		}
+		lastStage = pool.currentStage
+		pool.lock.Unlock()
+
+		pool.processSections(lastStage)
+	}
+}
+
+// close stops the workers once they finish the current stage.
+func (pool *workerPool) close() {
+	pool.lock.Lock()
+	pool.closed = true
+	pool.lock.Unlock()
+	pool.stageReady.Broadcast()
+}
+
+// section returns the part [start, end) of [min, max) that a section is responsible for. The last
+// section picks up the remainder when the range doesn't divide evenly.
+func (pool *workerPool) section(min, max, section int) (start, end int) {
+	division := (max - min) / pool.numberOfWorkers
+	start = min + section*division
+	end = start + division
+	if section == pool.numberOfWorkers-1 {
+		end = max
+	}
+	return start, end
+}
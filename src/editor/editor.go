@@ -2,49 +2,526 @@ package main
 
 import (
 	cp "compressionprocess"
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
 	r "regexp"
 	"runtime"
+	"runtime/debug"
 	"strconv"
+	s "strings"
+	"syscall"
+	"time"
 )
 
+// editorOptions stores the flags that can follow the input path.
+type editorOptions struct {
+	numThreads int
+	parallel   bool
+	scaleRateX string
+	scaleRateY string
+	outputDir  string
+	extensions []string
+	rulesPath  string
+	doneDir    string
+	failedDir  string
+	interval   time.Duration
+	timeout    time.Duration
+	maxMemory  int64
+
+	autoThreads  bool
+	profilePath  string
+	listen       string
+	workers      []string
+	recordSeams  bool
+	overlay      cp.OverlayStyle
+	debug        cp.DebugOptions
+	stats        bool
+	costLimit    *cp.SeamCostLimit
+	minWidth     int
+	width        int
+	nameTemplate string
+	collision    cp.CollisionPolicy
+	roots        cp.PathRoots
+}
+
+// parseOptions reads the flags that follow the input path.
+func parseOptions(args []string) (opts editorOptions, err error) {
+	threadsRe := r.MustCompile(`^-?p=(\d+)$`)
+	widthRe := r.MustCompile(`^--(min-)?width=(\d+)$`)
+	scaleRe := r.MustCompile(`^--scale=([^,]+)(?:,([^,]+))?$`)
+	opts.extensions = []string{".png"}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "p" || arg == "-p":
+			opts.parallel = true
+			opts.numThreads = runtime.NumCPU()
+		case arg == "p=auto" || arg == "-p=auto":
+			opts.parallel = true
+			opts.autoThreads = true
+			opts.numThreads = runtime.NumCPU()
+		case threadsRe.MatchString(arg):
+			opts.parallel = true
+			opts.numThreads, err = strconv.Atoi(threadsRe.FindStringSubmatch(arg)[1])
+			if err != nil {
+				return opts, fmt.Errorf("Invalid Arguments. For parralel processing please include p or p=[number of threads]")
+			}
+		case widthRe.MatchString(arg):
+			width := widthRe.FindStringSubmatch(arg)
+			if width[1] != "" {
+				opts.minWidth, err = strconv.Atoi(width[2])
+			} else {
+				opts.width, err = strconv.Atoi(width[2])
+			}
+		case scaleRe.MatchString(arg):
+			scale := scaleRe.FindStringSubmatch(arg)
+			opts.scaleRateX, opts.scaleRateY = scale[1], scale[2]
+			// One rate scales both dimensions.
+			if opts.scaleRateY == "" {
+				opts.scaleRateY = opts.scaleRateX
+			}
+		case s.HasPrefix(arg, "--out="):
+			opts.outputDir, err = cp.ExpandHome(s.TrimPrefix(arg, "--out="))
+		case s.HasPrefix(arg, "--input-root="):
+			opts.roots.InputRoot = s.TrimPrefix(arg, "--input-root=")
+		case s.HasPrefix(arg, "--output-root="):
+			opts.roots.OutputRoot = s.TrimPrefix(arg, "--output-root=")
+		case s.HasPrefix(arg, "--ext="):
+			opts.extensions = s.Split(s.TrimPrefix(arg, "--ext="), ",")
+		case s.HasPrefix(arg, "--rules="):
+			opts.rulesPath = s.TrimPrefix(arg, "--rules=")
+		case s.HasPrefix(arg, "--done="):
+			opts.doneDir = s.TrimPrefix(arg, "--done=")
+		case s.HasPrefix(arg, "--failed="):
+			opts.failedDir = s.TrimPrefix(arg, "--failed=")
+		case s.HasPrefix(arg, "--name="):
+			opts.nameTemplate = s.TrimPrefix(arg, "--name=")
+		case s.HasPrefix(arg, "--on-exists="):
+			opts.collision, err = cp.ParseCollisionPolicy(s.TrimPrefix(arg, "--on-exists="))
+			if err != nil {
+				return opts, err
+			}
+		case arg == "--seams":
+			opts.recordSeams = true
+		case arg == "--stats":
+			opts.stats = true
+		case s.HasPrefix(arg, "--max-seam-cost="):
+			opts.costLimit, err = cp.ParseSeamCostLimit(s.TrimPrefix(arg, "--max-seam-cost="))
+		case arg == "--overlay":
+			opts.overlay = cp.SolidOverlay
+		case s.HasPrefix(arg, "--overlay="):
+			opts.overlay, err = cp.ParseOverlayStyle(s.TrimPrefix(arg, "--overlay="))
+		case s.HasPrefix(arg, "--debug="):
+			opts.debug.Dir, err = cp.ExpandHome(s.TrimPrefix(arg, "--debug="))
+		case s.HasPrefix(arg, "--debug-steps="):
+			opts.debug.Steps, err = cp.ParseDebugSteps(s.TrimPrefix(arg, "--debug-steps="))
+		case s.HasPrefix(arg, "--debug-format="):
+			opts.debug.Formats, err = cp.ParseDebugFormats(s.TrimPrefix(arg, "--debug-format="))
+		case s.HasPrefix(arg, "--colormap="):
+			opts.debug.ColorMap, err = cp.ParseColorMap(s.TrimPrefix(arg, "--colormap="))
+		case arg == "--listen" && i+1 < len(args):
+			i++
+			opts.listen = args[i]
+		case s.HasPrefix(arg, "--listen="):
+			opts.listen = s.TrimPrefix(arg, "--listen=")
+		case s.HasPrefix(arg, "--workers="):
+			opts.workers = s.Split(s.TrimPrefix(arg, "--workers="), ",")
+		case s.HasPrefix(arg, "--profile="):
+			opts.profilePath, err = cp.ExpandHome(s.TrimPrefix(arg, "--profile="))
+		case s.HasPrefix(arg, "--timeout="):
+			opts.timeout, err = time.ParseDuration(s.TrimPrefix(arg, "--timeout="))
+			if err != nil {
+				return opts, fmt.Errorf("Invalid timeout: %s", arg)
+			}
+		case s.HasPrefix(arg, "--max-memory="):
+			opts.maxMemory, err = cp.ParseMemorySize(s.TrimPrefix(arg, "--max-memory="))
+		case s.HasPrefix(arg, "--interval="):
+			opts.interval, err = time.ParseDuration(s.TrimPrefix(arg, "--interval="))
+			if err != nil {
+				return opts, fmt.Errorf("Invalid interval: %s", arg)
+			}
+		default:
+			return opts, fmt.Errorf("Unknown argument: %s", arg)
+		}
+		if err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// isDirectoryInput checks if the input is a directory or glob pattern rather than a CSV.
+func isDirectoryInput(inputPath string) bool {
+	if cp.IsGlobPattern(inputPath) {
+		return true
+	}
+	info, err := os.Stat(inputPath)
+	return err == nil && info.IsDir()
+}
+
+// getJobs reads the jobs from the CSV, or searches the directory for images when there's no CSV.
+func getJobs(inputPath string, opts editorOptions) (jobs []cp.CompressionJob, err error) {
+	if !isDirectoryInput(inputPath) {
+		jobs, err = cp.ReadManifest(inputPath, opts.roots)
+	} else if opts.scaleRateX == "" || opts.outputDir == "" {
+		return nil, fmt.Errorf("Directory inputs need --scale=[x rate],[y rate] and --out=[output directory]")
+	} else {
+		jobs, err = cp.FindImageJobs(inputPath, opts.outputDir, opts.scaleRateX, opts.scaleRateY, opts.extensions)
+		for i := range jobs {
+			jobs[i].OutputPath = cp.ApplyNameTemplate(jobs[i].OutputPath, opts.nameTemplate)
+		}
+	}
+	profile := loadThreadProfile(opts)
+	for i := range jobs {
+		jobs[i].ThreadProfile = profile
+		jobs[i].Collision = opts.collision
+		jobs[i].Timeout = opts.timeout
+		jobs[i].RecordSeams = opts.recordSeams
+		jobs[i].Overlay = opts.overlay
+		jobs[i].Debug = debugOptions(opts)
+		jobs[i].Stats = opts.stats
+		jobs[i].SeamCostLimit = opts.costLimit
+	}
+	return jobs, err
+}
+
+// loadThreadProfile loads the thread profile used by p=auto, calibrating it first if it hasn't been saved.
+// It returns nil if the number of threads wasn't left to p=auto or there's only one CPU to use.
+func loadThreadProfile(opts editorOptions) *cp.ThreadProfile {
+	if !opts.autoThreads {
+		return nil
+	}
+	if opts.numThreads < 2 {
+		fmt.Println("Auto: only 1 CPU, compressing sequentially")
+		return nil
+	}
+	path := opts.profilePath
+	if path == "" {
+		path = cp.DefaultThreadProfilePath()
+	}
+	profile, err := cp.LoadThreadProfile(path, opts.numThreads)
+	if err != nil {
+		// The calibrated profile can still be used even if it couldn't be saved.
+		fmt.Println("Couldn't save thread profile:", err)
+	}
+	return profile
+}
+
+// debugOptions returns the debug output asked for with --debug, saving the first seam as a gray png unless
+// other steps, formats or a color map were given. It returns nil without --debug.
+func debugOptions(opts editorOptions) *cp.DebugOptions {
+	if opts.debug.Dir == "" {
+		return nil
+	}
+	debug := opts.debug
+	if debug.Steps == nil {
+		debug.Steps = []int{1}
+	}
+	if debug.Formats == nil {
+		debug.Formats = []string{"png"}
+	}
+	if debug.ColorMap == "" {
+		debug.ColorMap = "gray"
+	}
+	return &debug
+}
+
+// cancelOnSignal returns a context that is cancelled on the first interrupt or SIGTERM, so no new images
+// are started and the ones being compressed stop at their next seam. Images already being written out are
+// finished. A second signal removes any half written outputs and exits straight away.
+func cancelOnSignal() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Println("Stopping... press Ctrl-C again to quit straight away")
+		cancel()
+		<-signals
+		fmt.Println("Quitting")
+		cp.RemovePartialOutputs()
+		os.Exit(130)
+	}()
+	return ctx
+}
+
+// newExecutor picks where the images are compressed: on the workers given, on a pool of threads or one after
+// the other.
+func newExecutor(opts editorOptions) cp.Executor {
+	if len(opts.workers) > 0 {
+		fmt.Println("Running Distributed Application With", len(opts.workers), "workers...")
+		return cp.DistributedExecutor{Workers: opts.workers}
+	}
+	if !opts.parallel {
+		fmt.Println("Running Sequential Application...")
+		return cp.SerialExecutor{MaxMemory: opts.maxMemory}
+	}
+	// Run with default number of threads or user provided
+	fmt.Println("Running Parralel Application With", opts.numThreads, " threads...")
+	if opts.numThreads > 1 {
+		return cp.PoolExecutor{Threads: opts.numThreads, MaxMemory: opts.maxMemory}
+	}
+	return cp.SerialExecutor{MaxMemory: opts.maxMemory}
+}
+
+// limitMemory keeps the garbage collector inside the memory budget, if there is one.
+func limitMemory(maxMemory int64) {
+	if maxMemory > 0 {
+		debug.SetMemoryLimit(maxMemory)
+	}
+}
+
+// watch compresses images as they are dropped into a directory until the process is stopped.
+func watch(args []string) {
+	if len(args) < 1 {
+		fmt.Println("No Directory To Watch Provided")
+		return
+	}
+	dropDir := filepath.Clean(args[0])
+	opts, err := parseOptions(args[1:])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if opts.rulesPath == "" || opts.outputDir == "" {
+		fmt.Println("Watching needs --rules=[rules csv] and --out=[output directory]")
+		return
+	}
+	rules, err := cp.ReadWatchRules(opts.rulesPath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	// Finished originals are kept in the drop directory unless told otherwise.
+	if opts.doneDir == "" {
+		opts.doneDir = filepath.Join(dropDir, "done")
+	}
+	if opts.failedDir == "" {
+		opts.failedDir = filepath.Join(dropDir, "failed")
+	}
+
+	limitMemory(opts.maxMemory)
+	fmt.Println("Watching", dropDir, "...")
+	err = cp.WatchFolder(cancelOnSignal(), cp.WatchOptions{
+		DropDir:    dropDir,
+		OutputDir:  filepath.Clean(opts.outputDir),
+		DoneDir:    filepath.Clean(opts.doneDir),
+		FailedDir:  filepath.Clean(opts.failedDir),
+		Rules:      rules,
+		Extensions: opts.extensions,
+		Interval:   opts.interval,
+		Executor:   newExecutor(opts),
+		Timeout:    opts.timeout,
+
+		NameTemplate:  opts.nameTemplate,
+		Collision:     opts.collision,
+		ThreadProfile: loadThreadProfile(opts),
+		RecordSeams:   opts.recordSeams,
+		Overlay:       opts.overlay,
+		Debug:         debugOptions(opts),
+		Stats:         opts.stats,
+		SeamCostLimit: opts.costLimit})
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// worker compresses the images sent to it by a coordinator running with --workers until the process is stopped.
+func worker(args []string) {
+	opts, err := parseOptions(args)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if opts.listen == "" {
+		fmt.Println("Workers need --listen [address], such as --listen :7000")
+		return
+	}
+	threads := 1
+	if opts.parallel {
+		threads = opts.numThreads
+	}
+	limitMemory(opts.maxMemory)
+	if err := cp.ServeWorker(cancelOnSignal(), opts.listen, threads, opts.maxMemory); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// validate checks a CSV without compressing anything and exits with an error if any line has problems.
+func validate(args []string) {
+	if len(args) < 1 {
+		fmt.Println("No CSV Provided")
+		os.Exit(1)
+	}
+	opts, err := parseOptions(args[1:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	problems, err := cp.ValidateManifest(args[0], opts.roots, opts.collision)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
+
+// replay removes the seams recorded with --seams from other images of the same size, such as masks or depth maps,
+// so they stay aligned with the carved image. The seam file is followed by pairs of input and output paths.
+func replay(args []string) {
+	paths := args
+	for len(paths) > 0 && s.HasPrefix(paths[len(paths)-1], "-") {
+		paths = paths[:len(paths)-1]
+	}
+	if len(paths) < 3 || len(paths)%2 == 0 {
+		fmt.Println("Replay needs a seam file followed by pairs of input and output images")
+		os.Exit(1)
+	}
+	opts, err := parseOptions(args[len(paths):])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	seamFile, err := cp.ReadSeamFile(paths[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ctx := cancelOnSignal()
+	failures := 0
+	for i := 1; i < len(paths); i += 2 {
+		if err := cp.ReplaySeamFile(ctx, seamFile, paths[i], paths[i+1], opts.collision); err != nil {
+			fmt.Println(paths[i], "-", err)
+			failures++
+			continue
+		}
+		fmt.Println("Replayed", len(seamFile.Seams), "seams from", paths[i], "to", paths[i+1])
+	}
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
+
+// buildIndexMap carves an image down to --min-width (1 by default) and writes the map of when each pixel was removed,
+// which reconstruct uses to shrink the image to any width in between.
+func buildIndexMap(args []string) {
+	if len(args) < 2 {
+		fmt.Println("index-map needs an input image and the path to write the map to")
+		os.Exit(1)
+	}
+	opts, err := parseOptions(args[2:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	sourceImage, err := cp.ReadImage(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if opts.minWidth == 0 {
+		opts.minWidth = 1
+	}
+	threads := 1
+	if opts.parallel {
+		threads = opts.numThreads
+	}
+
+	start := time.Now()
+	indexMap, err := cp.BuildIndexMap(cancelOnSignal(), sourceImage, opts.minWidth, threads)
+	if err == nil {
+		_, err = cp.WriteIndexMap(args[1], indexMap, opts.collision)
+	}
+	if err != nil {
+		fmt.Println(args[0], "-", err)
+		os.Exit(1)
+	}
+	fmt.Println("Wrote a map for widths", indexMap.MinWidth, "to", indexMap.Width, "to", args[1], "in", time.Since(start).Round(time.Millisecond))
+}
+
+// reconstruct shrinks an image to --width using the map written by index-map, without finding any seams.
+func reconstruct(args []string) {
+	if len(args) < 3 {
+		fmt.Println("reconstruct needs an input image, its map and an output path")
+		os.Exit(1)
+	}
+	opts, err := parseOptions(args[3:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if opts.width == 0 {
+		fmt.Println("reconstruct needs --width=[width]")
+		os.Exit(1)
+	}
+	sourceImage, err := cp.ReadImage(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	indexMap, err := cp.ReadIndexMap(args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	output, err := indexMap.Reconstruct(sourceImage, opts.width)
+	if err == nil {
+		_, err = cp.WriteImage(args[2], output, opts.collision)
+	}
+	if err != nil {
+		fmt.Println(args[0], "-", err)
+		os.Exit(1)
+	}
+}
+
 func main() {
 	args := os.Args
 	if len(args) < 2 {
 		fmt.Println("No CSV Provided")
 		return
 	}
-	csvPath := args[1]
-	re := r.MustCompile("p=(\\d+)")
-	if len(args) < 3 {
-		fmt.Println("Running Sequential Application...")
-		cp.LaunchSeqApplication(csvPath)
-		return
-	}
-	var numCpusInt int
-	var e error
-	// Parse Flags
-	numCpus := re.FindStringSubmatch(args[2])
-	if numCpus != nil {
-		numCpusInt, e = strconv.Atoi(numCpus[1])
-		if e != nil {
-			fmt.Println("Invalid Arguments. For parralel processing please include p or p=[number of threads]")
-			return
-		}
+	switch args[1] {
+	case "watch":
+		watch(args[2:])
+		return
+	case "validate":
+		validate(args[2:])
+		return
+	case "worker":
+		worker(args[2:])
+		return
+	case "replay":
+		replay(args[2:])
+		return
+	case "index-map":
+		buildIndexMap(args[2:])
+		return
+	case "reconstruct":
+		reconstruct(args[2:])
+		return
 	}
-
-	// Run with default number of threads or user provided
-	if args[2] == "-p" {
-		fmt.Println("Running Parralel Application With", runtime.NumCPU(), " threads...")
-		cp.LaunchConcurrentApplication(runtime.NumCPU(), csvPath)
-	} else {
-		fmt.Println("Running Parralel Application With", numCpusInt, " threads...")
-		if numCpusInt > 1 {
-			cp.LaunchConcurrentApplication(numCpusInt, csvPath)
-		} else {
-			cp.LaunchSeqApplication(csvPath)
-		}
+	inputPath := args[1]
+	opts, err := parseOptions(args[2:])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	jobs, err := getJobs(inputPath, opts)
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
 
+	limitMemory(opts.maxMemory)
+	ctx := cancelOnSignal()
+	cp.PrintReport(cp.LaunchJobs(ctx, newExecutor(opts), jobs))
+	if ctx.Err() != nil {
+		os.Exit(130)
+	}
 }
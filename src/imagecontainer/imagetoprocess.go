@@ -1,14 +1,10 @@
 package imagecontainer
 
 import (
-	"bufio"
 	"filter"
-	"fmt"
 	"image"
 	"math"
-	"os"
 	pc "pixelcolor"
-	"strings"
 )
 
 // Constants for instructions
@@ -20,56 +16,187 @@ const (
 	IRemoveColumn           = iota
 )
 
-// ImageToProcess stores the information on an image and the filters being applied to it.
+// The Sobel filters are copied into arrays once so the hot path doesn't index slices of slices.
+var xGradientFilter, yGradientFilter = filterArray(filter.XGradientFilter()), filterArray(filter.YGradientFilter())
+
+// EnergyFunc returns the energy of the pixel at x, y in the current image. Seams follow the pixels with the
+// least energy.
+type EnergyFunc func(currentImage *image.RGBA, x, y int) float32
+
+// ImageToProcess stores the information on an image and the buffers used while compressing it.
+// The image is compressed in place. Removing a seam shifts the pixels after it and shrinks the image's
+// bounds, so the pixel buffer and the flat CumulativeMagnitude buffer keep the stride of the original
+// image and are reused for every seam.
 type ImageToProcess struct {
-	OutputFileName         string
-	CurrentImage           image.Image
-	NewImage               *image.RGBA
-	CumulativeMagnitude    [][]float32
-	ImageCompressionBounds chan CompressionBounds
-	CurrentStageComplete   chan interface{}
-	InstructionsComplete   chan int
-	TargetX                int
-	TargetY                int
-}
-
-// GetPixelMagnitudes loops through each pixel of the padded image, gets the new pixel color by
-// applying the specified filter and sets the new image's pixel to that new color.
-// this returns the image of the gradient magnitudes to ensure the calculations are done correctly.
-func (imageToProcess *ImageToProcess) GetPixelMagnitudes(compressionBounds CompressionBounds) image.Image {
-	newImage := image.NewRGBA(image.Rect(imageToProcess.CurrentImage.Bounds().Min.X, imageToProcess.CurrentImage.Bounds().Min.X, imageToProcess.CurrentImage.Bounds().Max.X, imageToProcess.CurrentImage.Bounds().Max.Y))
-	// Loop through padded image.
+	OutputFileName string
+	// SourceImage is the decoded image when it isn't RGBA. Its colours can't be read straight from
+	// bytes without changing the gradients, so it's used for the first seam and dropped after that.
+	SourceImage         image.Image
+	CurrentImage        *image.RGBA
+	CumulativeMagnitude []float32
+	MagnitudeStride     int
+	TargetX             int
+	TargetY             int
+
+	// energy replaces the gradient magnitude if it's set, see SetEnergy.
+	energy EnergyFunc
+	// These are only used to record seams, see RecordSeams. origin is the top left of the source image.
+	originalPositions []int32
+	seams             []Seam
+	origin            image.Point
+	// layers are carved along with the image, see AddLayer.
+	layers []layer
+	// seamLimit stops carving early if it's set, see SetSeamLimit.
+	seamLimit *SeamLimit
+
+	// These are only used by the low memory path, see NewLowMemoryImageToProcess.
+	seamParents     []int8
+	lowMemoryRows   [2][]float32
+	seam            []int
+	sharesSourcePix bool
+}
+
+// NewImageToProcess copies the source image into an RGBA image that can be compressed in place and
+// allocates the magnitude buffer for it.
+func NewImageToProcess(outputFileName string, sourceImage image.Image, targetX, targetY int) *ImageToProcess {
+	width, height := sourceImage.Bounds().Dx(), sourceImage.Bounds().Dy()
+	imageToProcess := ImageToProcess{
+		OutputFileName:      outputFileName,
+		CumulativeMagnitude: make([]float32, width*height),
+		MagnitudeStride:     width,
+		TargetX:             targetX,
+		TargetY:             targetY,
+		origin:              sourceImage.Bounds().Min}
+	imageToProcess.copySourceImage(sourceImage)
+	return &imageToProcess
+}
+
+// copySourceImage copies the source image into a new RGBA image. Unless the source is RGBA, it's kept
+// to find the first seam from.
+func (imageToProcess *ImageToProcess) copySourceImage(sourceImage image.Image) {
+	bounds := sourceImage.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	currentImage := image.NewRGBA(image.Rect(0, 0, width, height))
+	imageToProcess.CurrentImage = currentImage
+
+	if rgbaImage, ok := sourceImage.(*image.RGBA); ok {
+		for y := 0; y < height; y++ {
+			copy(currentImage.Pix[y*currentImage.Stride:(y+1)*currentImage.Stride], rgbaImage.Pix[rgbaImage.PixOffset(bounds.Min.X, bounds.Min.Y+y):])
+		}
+		return
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			currentImage.Set(x, y, sourceImage.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	imageToProcess.SourceImage = sourceImage
+}
+
+// SetEnergy finds seams using the energy function instead of the gradient magnitude. The energy is read from
+// the current image, so the decoded image isn't kept for the first seam.
+func (imageToProcess *ImageToProcess) SetEnergy(energy EnergyFunc) {
+	imageToProcess.releaseSourceImage()
+	imageToProcess.energy = energy
+}
+
+// filterArray copies a 3x3 filter into an array.
+func filterArray(filter [][]int32) (array [3][3]int32) {
+	for sx := range array {
+		copy(array[sx][:], filter[sx])
+	}
+	return array
+}
+
+// Width returns the current width of the image.
+func (imageToProcess *ImageToProcess) Width() int {
+	return imageToProcess.CurrentImage.Rect.Dx()
+}
+
+// Height returns the current height of the image.
+func (imageToProcess *ImageToProcess) Height() int {
+	return imageToProcess.CurrentImage.Rect.Dy()
+}
+
+// OutputImage returns the image to write out. If no seams were removed, it's the decoded image.
+func (imageToProcess *ImageToProcess) OutputImage() image.Image {
+	if imageToProcess.SourceImage != nil {
+		return imageToProcess.SourceImage
+	}
+	return imageToProcess.CurrentImage
+}
+
+// magnitudeIndex returns the index of a pixel in CumulativeMagnitude.
+func (imageToProcess *ImageToProcess) magnitudeIndex(x, y int) int {
+	return y*imageToProcess.MagnitudeStride + x
+}
+
+// GetPixelMagnitudes loops through each pixel in the bounds, applies the gradient filters to it and
+// stores its gradient magnitude in CumulativeMagnitude.
+func (imageToProcess *ImageToProcess) GetPixelMagnitudes(compressionBounds CompressionBounds) {
+	width, height := imageToProcess.Width(), imageToProcess.Height()
 	for x := compressionBounds.MinX; x <= compressionBounds.MaxX; x++ {
 		for y := compressionBounds.MinY; y <= compressionBounds.MaxY; y++ {
-			// get the new pixel color
-			xCoord, yCoord := x, y
-
-			// This prevents striking edges caused by applying a filter that goes into the padding.
-			// It assumes the last pixel is probably similar to the one before it.
-			if xCoord+1 > imageToProcess.CurrentImage.Bounds().Max.X-1 {
-				xCoord = imageToProcess.CurrentImage.Bounds().Max.X - 2
-			}
-			if yCoord+1 > imageToProcess.CurrentImage.Bounds().Max.Y-1 {
-				yCoord = imageToProcess.CurrentImage.Bounds().Max.Y - 2
-			}
+			imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)] = imageToProcess.pixelMagnitude(x, y, width, height)
+		}
+	}
+}
 
-			xGradientOfPixel := addFilterToPixel(xCoord, yCoord, filter.XGradientFilter(), imageToProcess.CurrentImage)
-			yGradientOfPixel := addFilterToPixel(xCoord, yCoord, filter.YGradientFilter(), imageToProcess.CurrentImage)
-			var gradientMagnitude pc.PixelColor
-			imageToProcess.CumulativeMagnitude[y][x], gradientMagnitude = pc.GetGradientMagnitude(xGradientOfPixel, yGradientOfPixel)
-			newImage.Set(x, y, gradientMagnitude.ToRGBA())
+// Energy returns the magnitude of every pixel of the current image row by row, the same magnitudes the next
+// seam will be found from.
+func (imageToProcess *ImageToProcess) Energy() []float32 {
+	width, height := imageToProcess.Width(), imageToProcess.Height()
+	energy := make([]float32, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			energy[y*width+x] = imageToProcess.pixelMagnitude(x, y, width, height)
 		}
 	}
-	return newImage
+	return energy
+}
+
+// pixelMagnitude returns the magnitude of a pixel used to find seams, adding the weighted magnitudes of any
+// layers to the image's own.
+func (imageToProcess *ImageToProcess) pixelMagnitude(x, y, width, height int) float32 {
+	if imageToProcess.layers != nil {
+		return imageToProcess.imageMagnitude(x, y, width, height) + imageToProcess.layerMagnitude(x, y, width, height)
+	}
+	return imageToProcess.imageMagnitude(x, y, width, height)
+}
+
+// imageMagnitude applies the gradient filters to a pixel and returns its gradient magnitude, or returns the
+// pixel's energy if an energy function was set.
+func (imageToProcess *ImageToProcess) imageMagnitude(x, y, width, height int) float32 {
+	if imageToProcess.energy != nil {
+		return imageToProcess.energy(imageToProcess.CurrentImage, x, y)
+	}
+	// This prevents striking edges caused by applying a filter that goes into the padding.
+	// It assumes the last pixel is probably similar to the one before it.
+	if x+1 > width-1 {
+		x = width - 2
+	}
+	if y+1 > height-1 {
+		y = height - 2
+	}
+
+	var xGradientOfPixel, yGradientOfPixel pc.PixelColor
+	if imageToProcess.SourceImage != nil {
+		xGradientOfPixel = addFilterToPixel(x, y, xGradientFilter, imageToProcess.SourceImage)
+		yGradientOfPixel = addFilterToPixel(x, y, yGradientFilter, imageToProcess.SourceImage)
+	} else {
+		xGradientOfPixel, yGradientOfPixel = imageToProcess.addFiltersToPixel(x, y, width, height)
+	}
+	return pc.GradientMagnitude(xGradientOfPixel, yGradientOfPixel)
 }
 
 // addFilterToPixel multiplies the pixels color values through the filter and sums them up.
 // It then removes negagive values and returns a pixelColor struct of the new rgba values
 // for that pixel in the new image.
-func addFilterToPixel(x, y int, filter [][]int32, paddedImage image.Image) pc.PixelColor {
+func addFilterToPixel(x, y int, filter [3][3]int32, paddedImage image.Image) pc.PixelColor {
 	pixelColor := pc.PixelColor{}
+	min := paddedImage.Bounds().Min
 	// a is preserved in the new image.
-	_, _, _, a := paddedImage.At(x, y).RGBA()
+	_, _, _, a := paddedImage.At(min.X+x, min.Y+y).RGBA()
 	pixelColor.A = int32(a)
 
 	// apply the filter over the 9 pixels around the target pixel.
@@ -77,7 +204,7 @@ func addFilterToPixel(x, y int, filter [][]int32, paddedImage image.Image) pc.Pi
 		for sy := 0; sy < 3; sy++ {
 			xCoord := x - 1 + sx
 			yCoord := y - 1 + sy
-			r, g, b, _ := paddedImage.At(xCoord, yCoord).RGBA()
+			r, g, b, _ := paddedImage.At(min.X+xCoord, min.Y+yCoord).RGBA()
 			// Divided by 257 because the color is offset when stored as RGBA by 0x101 and this ultimate needs
 			// to be 8 bits.
 			pixelColor.R += int32(r/257) * filter[sx][sy]
@@ -90,6 +217,36 @@ func addFilterToPixel(x, y int, filter [][]int32, paddedImage image.Image) pc.Pi
 	return pixelColor
 }
 
+// addFiltersToPixel applies both gradient filters to a pixel, reading the colors straight from the
+// current image's bytes. Pixels outside the image count as black, the same as At returns for them.
+func (imageToProcess *ImageToProcess) addFiltersToPixel(x, y, width, height int) (xGradient, yGradient pc.PixelColor) {
+	pix, stride := imageToProcess.CurrentImage.Pix, imageToProcess.CurrentImage.Stride
+	for sx := 0; sx < 3; sx++ {
+		xCoord := x - 1 + sx
+		if xCoord < 0 || xCoord >= width {
+			continue
+		}
+		for sy := 0; sy < 3; sy++ {
+			yCoord := y - 1 + sy
+			if yCoord < 0 || yCoord >= height {
+				continue
+			}
+			i := yCoord*stride + xCoord*4
+			r, g, b := int32(pix[i]), int32(pix[i+1]), int32(pix[i+2])
+			xWeight, yWeight := xGradientFilter[sx][sy], yGradientFilter[sx][sy]
+			xGradient.R += r * xWeight
+			xGradient.G += g * xWeight
+			xGradient.B += b * xWeight
+			yGradient.R += r * yWeight
+			yGradient.G += g * yWeight
+			yGradient.B += b * yWeight
+		}
+	}
+	xGradient.RemoveNegativeColors()
+	yGradient.RemoveNegativeColors()
+	return xGradient, yGradient
+}
+
 // MinimzeHorizontalSeam loops through each pixel of the row, gets the min cumulative gradient to a parent pixel and updates
 // the value of the given cumulativeMagnitude location to sum that path value plus the magnitude of the current pixel.
 func (imageToProcess *ImageToProcess) MinimzeHorizontalSeam(compressionBounds CompressionBounds) {
@@ -97,8 +254,7 @@ func (imageToProcess *ImageToProcess) MinimzeHorizontalSeam(compressionBounds Co
 	for x := compressionBounds.MinX; x < compressionBounds.MaxX; x++ {
 		for y := compressionBounds.MinY; y <= compressionBounds.MaxY; y++ {
 			minX, minY := imageToProcess.getMinMag(x-1, y-1, x-1, y, x-1, y+1)
-			minParentMag := imageToProcess.CumulativeMagnitude[minY][minX]
-			imageToProcess.CumulativeMagnitude[y][x] = imageToProcess.CumulativeMagnitude[y][x] + minParentMag
+			imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)] += imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(minX, minY)]
 		}
 	}
 }
@@ -110,8 +266,7 @@ func (imageToProcess *ImageToProcess) MinimzeVerticalSeam(compressionBounds Comp
 	for y := compressionBounds.MinY; y < compressionBounds.MaxY; y++ {
 		for x := compressionBounds.MinX; x <= compressionBounds.MaxX; x++ {
 			minX, minY := imageToProcess.getMinMag(x-1, y-1, x, y-1, x+1, y-1)
-			minParentMag := imageToProcess.CumulativeMagnitude[minY][minX]
-			imageToProcess.CumulativeMagnitude[y][x] = imageToProcess.CumulativeMagnitude[y][x] + minParentMag
+			imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)] += imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(minX, minY)]
 		}
 	}
 }
@@ -120,10 +275,10 @@ func (imageToProcess *ImageToProcess) MinimzeVerticalSeam(compressionBounds Comp
 func (imageToProcess *ImageToProcess) FindMinSeam(compressionBounds CompressionBounds) (minSeamX, minSeamY int) {
 	var minSeamValue float32 = math.MaxFloat32
 
-	for x := compressionBounds.MinX; x <= compressionBounds.MaxX && x < imageToProcess.CurrentImage.Bounds().Max.X; x++ {
-		for y := compressionBounds.MinY; y <= compressionBounds.MaxY && y < imageToProcess.CurrentImage.Bounds().Max.Y; y++ {
-			if imageToProcess.CumulativeMagnitude[y][x] < minSeamValue {
-				minSeamValue = imageToProcess.CumulativeMagnitude[y][x]
+	for x := compressionBounds.MinX; x <= compressionBounds.MaxX && x < imageToProcess.Width(); x++ {
+		for y := compressionBounds.MinY; y <= compressionBounds.MaxY && y < imageToProcess.Height(); y++ {
+			if magnitude := imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)]; magnitude < minSeamValue {
+				minSeamValue = magnitude
 				minSeamX = x
 				minSeamY = y
 			}
@@ -133,24 +288,48 @@ func (imageToProcess *ImageToProcess) FindMinSeam(compressionBounds CompressionB
 }
 
 // MarkVerticalSeam loops to continuously find the parent above with the min gradient and mark it.
+// If seams are being recorded, the seam is recorded too.
 func (imageToProcess *ImageToProcess) MarkVerticalSeam(x, y int) {
-	imageToProcess.CumulativeMagnitude[y][x] = -1
-	for y > 0 && x >= 0 {
+	recording := imageToProcess.recordingSeams()
+	cost := imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)]
+	imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)] = -1
+	for {
+		if recording {
+			imageToProcess.seam[y] = x
+		}
+		if !(y > 0 && x >= 0) {
+			break
+		}
 		x, y = imageToProcess.markMinMag(x-1, y-1, x, y-1, x+1, y-1)
 	}
+	if recording {
+		imageToProcess.recordSeam(true, cost)
+	}
 }
 
 // MarkHorizontalSeam loops to continuously find the parent to the left with the min gradient and mark it.
+// If seams are being recorded, the seam is recorded too.
 func (imageToProcess *ImageToProcess) MarkHorizontalSeam(x, y int) {
-	imageToProcess.CumulativeMagnitude[y][x] = -1
-	for x > 0 && y >= 0 {
+	recording := imageToProcess.recordingSeams()
+	cost := imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)]
+	imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)] = -1
+	for {
+		if recording {
+			imageToProcess.seam[x] = y
+		}
+		if !(x > 0 && y >= 0) {
+			break
+		}
 		x, y = imageToProcess.markMinMag(x-1, y-1, x-1, y, x-1, y+1)
 	}
+	if recording {
+		imageToProcess.recordSeam(false, cost)
+	}
 }
 
-//Checks if x and y are within bounds of CumulativeMagnitude
+//Checks if x and y are within the current bounds of the image
 func (imageToProcess *ImageToProcess) coordinatesInBounds(x, y int) bool {
-	return (x > -1 && y > -1 && x < cap(imageToProcess.CumulativeMagnitude[0]) && y < cap(imageToProcess.CumulativeMagnitude))
+	return (x > -1 && y > -1 && x < imageToProcess.Width() && y < imageToProcess.Height())
 }
 
 //MarkMinMag marks the parent with the min magnitude with -1 and returns the coordinates.
@@ -161,11 +340,12 @@ func (imageToProcess *ImageToProcess) getMinMag(x1, y1, x2, y2, x3, y3 int) (min
 		minX, minY = x3, y3
 	}
 
-	if imageToProcess.coordinatesInBounds(x2, y2) && imageToProcess.CumulativeMagnitude[minY][minX] > imageToProcess.CumulativeMagnitude[y2][x2] {
+	magnitude := imageToProcess.CumulativeMagnitude
+	if imageToProcess.coordinatesInBounds(x2, y2) && magnitude[imageToProcess.magnitudeIndex(minX, minY)] > magnitude[imageToProcess.magnitudeIndex(x2, y2)] {
 		minX, minY = x2, y2
 	}
 
-	if imageToProcess.coordinatesInBounds(x3, y3) && imageToProcess.CumulativeMagnitude[minY][minX] > imageToProcess.CumulativeMagnitude[y3][x3] {
+	if imageToProcess.coordinatesInBounds(x3, y3) && magnitude[imageToProcess.magnitudeIndex(minX, minY)] > magnitude[imageToProcess.magnitudeIndex(x3, y3)] {
 		minX, minY = x3, y3
 	}
 	return minX, minY
@@ -173,45 +353,72 @@ func (imageToProcess *ImageToProcess) getMinMag(x1, y1, x2, y2, x3, y3 int) (min
 
 func (imageToProcess *ImageToProcess) markMinMag(x1, y1, x2, y2, x3, y3 int) (minX, minY int) {
 	minX, minY = imageToProcess.getMinMag(x1, y1, x2, y2, x3, y3)
-	imageToProcess.CumulativeMagnitude[minY][minX] = -1
+	imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(minX, minY)] = -1
 	return minX, minY
 }
 
-// RemoveColumn Creates a new image with one fewer row and adds colors from the current image,
-// skipping pixels marked as the seam to remove in the CumulativeMagnitude array.
+// RemoveColumn shifts the pixels in each row (and in each layer) left over the pixel marked as the seam to
+// remove in the CumulativeMagnitude array. DropLastColumn has to be called once every row has been shifted.
 func (imageToProcess *ImageToProcess) RemoveColumn(compressionBounds CompressionBounds) {
-	newImageX, newImageY := compressionBounds.MinX, compressionBounds.MinY
+	pix, stride := imageToProcess.CurrentImage.Pix, imageToProcess.CurrentImage.Stride
+	recording := imageToProcess.recordingSeams()
 
 	// Loop through current image.
 	for y := compressionBounds.MinY; y < compressionBounds.MaxY; y++ {
+		newImageX := compressionBounds.MinX
 		for x := compressionBounds.MinX; x < compressionBounds.MaxX; x++ {
-			if imageToProcess.CumulativeMagnitude[y][x] > -1 {
-				imageToProcess.NewImage.Set(newImageX, newImageY, imageToProcess.CurrentImage.At(x, y))
+			if imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)] > -1 {
+				if newImageX != x {
+					copy(pix[y*stride+newImageX*4:y*stride+newImageX*4+4], pix[y*stride+x*4:])
+					if recording {
+						imageToProcess.moveOriginalPosition(x, y, newImageX, y)
+					}
+					imageToProcess.moveLayerPixels(x, y, newImageX, y)
+				}
 				newImageX++
 			}
 		}
-		newImageX = 0
-		newImageY++
 	}
 }
 
-// RemoveRow Creates a new image with one fewer row and adds colors from the current image,
-// skipping pixels marked as the seam to remove in the CumulativeMagnitude array.
+// RemoveRow shifts the pixels in each column (and in each layer) up over the pixel marked as the seam to
+// remove in the CumulativeMagnitude array. DropLastRow has to be called once every column has been shifted.
 func (imageToProcess *ImageToProcess) RemoveRow(compressionBounds CompressionBounds) {
-	newImageX, newImageY := compressionBounds.MinX, compressionBounds.MinY
+	pix, stride := imageToProcess.CurrentImage.Pix, imageToProcess.CurrentImage.Stride
+	recording := imageToProcess.recordingSeams()
+
 	// Loop through current image
 	for x := compressionBounds.MinX; x < compressionBounds.MaxX; x++ {
+		newImageY := compressionBounds.MinY
 		for y := compressionBounds.MinY; y < compressionBounds.MaxY; y++ {
-			if imageToProcess.CumulativeMagnitude[y][x] > -1 {
-				imageToProcess.NewImage.Set(newImageX, newImageY, imageToProcess.CurrentImage.At(x, y))
+			if imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)] > -1 {
+				if newImageY != y {
+					copy(pix[newImageY*stride+x*4:newImageY*stride+x*4+4], pix[y*stride+x*4:])
+					if recording {
+						imageToProcess.moveOriginalPosition(x, y, x, newImageY)
+					}
+					imageToProcess.moveLayerPixels(x, y, x, newImageY)
+				}
 				newImageY++
 			}
 		}
-		newImageY = 0
-		newImageX++
 	}
 }
 
+// DropLastColumn shrinks the image by a column after RemoveColumn has shifted every row.
+func (imageToProcess *ImageToProcess) DropLastColumn() {
+	imageToProcess.CurrentImage.Rect.Max.X--
+	imageToProcess.SourceImage = nil
+	imageToProcess.shrinkLayers(true)
+}
+
+// DropLastRow shrinks the image by a row after RemoveRow has shifted every column.
+func (imageToProcess *ImageToProcess) DropLastRow() {
+	imageToProcess.CurrentImage.Rect.Max.Y--
+	imageToProcess.SourceImage = nil
+	imageToProcess.shrinkLayers(false)
+}
+
 // ProcessInstruction takes a compressionBounds and executes the function identified by the instruction.
 func (imageToProcess *ImageToProcess) ProcessInstruction(compressionBounds CompressionBounds) {
 	switch compressionBounds.Instruction {
@@ -227,29 +434,3 @@ func (imageToProcess *ImageToProcess) ProcessInstruction(compressionBounds Compr
 		imageToProcess.RemoveRow(compressionBounds)
 	}
 }
-
-// Construct a 2d array for the cmulativeMagnitude slices
-func GetCumulativeMagnitudeSlice(xBounds, yBounds int) [][]float32 {
-	cumulativeMagnitude := make([][]float32, yBounds)
-	for i := range cumulativeMagnitude {
-		cumulativeMagnitude[i] = make([]float32, xBounds)
-	}
-	return cumulativeMagnitude
-}
-
-// WriteToCsv writes out the cumulative magnitude values at a given step during compression
-// to a csv in order to check if paths are being correctly identified.
-func (imageToProcess *ImageToProcess) WriteToCsv(path string, exit bool) {
-	f, err := os.Create(path)
-	fmt.Println(err)
-	w := bufio.NewWriter(f)
-	for _, row := range imageToProcess.CumulativeMagnitude {
-		st := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(row)), ", "), "[]") + "\n"
-		w.WriteString(st)
-	}
-	w.Flush()
-	f.Close()
-	if exit {
-		panic("CSV EXIT")
-	}
-}
@@ -0,0 +1,68 @@
+package imagecontainer
+
+import (
+	"errors"
+	"image"
+)
+
+// ErrLayerSize is returned by AddLayer when a layer isn't the same size as the image.
+var ErrLayerSize = errors.New("Layer isn't the same size as the image")
+
+// layer is another image carved along with the image, such as a mask or depth map. Its energy is scaled by the
+// weight and added to the image's when finding seams.
+type layer struct {
+	image  *ImageToProcess
+	weight float32
+}
+
+// AddLayer carves another image of the same size along with this one, removing the same seams from both so they
+// stay aligned. If the weight isn't 0, the layer's gradient magnitude times the weight is added to the image's
+// when finding seams. Layers have to be added before any seam is removed and take about 4 bytes a pixel on top
+// of the decoded image.
+func (imageToProcess *ImageToProcess) AddLayer(layerImage image.Image, weight float32) error {
+	if layerImage.Bounds().Size() != imageToProcess.CurrentImage.Rect.Size() {
+		return ErrLayerSize
+	}
+	layerToProcess := ImageToProcess{MagnitudeStride: imageToProcess.MagnitudeStride}
+	layerToProcess.copySourceImage(layerImage)
+	imageToProcess.layers = append(imageToProcess.layers, layer{image: &layerToProcess, weight: weight})
+	return nil
+}
+
+// Layers returns the layers added with AddLayer as they are now, in the order they were added.
+func (imageToProcess *ImageToProcess) Layers() []image.Image {
+	layers := make([]image.Image, len(imageToProcess.layers))
+	for i, layer := range imageToProcess.layers {
+		layers[i] = layer.image.OutputImage()
+	}
+	return layers
+}
+
+// layerMagnitude returns the weighted sum of the layers' gradient magnitudes at a pixel.
+func (imageToProcess *ImageToProcess) layerMagnitude(x, y, width, height int) (magnitude float32) {
+	for _, layer := range imageToProcess.layers {
+		if layer.weight != 0 {
+			magnitude += layer.weight * layer.image.pixelMagnitude(x, y, width, height)
+		}
+	}
+	return magnitude
+}
+
+// moveLayerPixels moves a pixel in every layer the same way a pixel of the image was moved by removing a seam.
+func (imageToProcess *ImageToProcess) moveLayerPixels(fromX, fromY, toX, toY int) {
+	for _, layer := range imageToProcess.layers {
+		currentImage := layer.image.CurrentImage
+		copy(currentImage.Pix[currentImage.PixOffset(toX, toY):currentImage.PixOffset(toX, toY)+4], currentImage.Pix[currentImage.PixOffset(fromX, fromY):])
+	}
+}
+
+// shrinkLayers drops the last column or row of every layer once a seam has been removed from them.
+func (imageToProcess *ImageToProcess) shrinkLayers(vertical bool) {
+	for _, layer := range imageToProcess.layers {
+		if vertical {
+			layer.image.DropLastColumn()
+		} else {
+			layer.image.DropLastRow()
+		}
+	}
+}
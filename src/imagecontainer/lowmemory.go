@@ -0,0 +1,198 @@
+package imagecontainer
+
+import (
+	"image"
+	"math"
+)
+
+// NewLowMemoryImageToProcess prepares an image to be compressed with RemoveVerticalSeamLowMemory and
+// RemoveHorizontalSeamLowMemory. Instead of a cumulative magnitude for every pixel, only two rows of them
+// are kept along with the direction of each pixel's parent in the seam search, and 8 bit RGBA images are
+// compressed in the decoded image's own buffer instead of a copy. This takes about 5 bytes a pixel instead
+// of 12, and the seams removed are the same.
+func NewLowMemoryImageToProcess(outputFileName string, sourceImage image.Image, targetX, targetY int) *ImageToProcess {
+	bounds := sourceImage.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	longestSide := width
+	if height > longestSide {
+		longestSide = height
+	}
+	imageToProcess := ImageToProcess{
+		OutputFileName:  outputFileName,
+		MagnitudeStride: width,
+		TargetX:         targetX,
+		TargetY:         targetY,
+		seamParents:     make([]int8, width*height),
+		lowMemoryRows:   [2][]float32{make([]float32, longestSide), make([]float32, longestSide)},
+		seam:            make([]int, longestSide),
+		origin:          bounds.Min}
+
+	switch source := sourceImage.(type) {
+	case *image.RGBA:
+		imageToProcess.CurrentImage = &image.RGBA{Pix: source.Pix[source.PixOffset(bounds.Min.X, bounds.Min.Y):], Stride: source.Stride, Rect: image.Rect(0, 0, width, height)}
+	case *image.NRGBA:
+		// The colors are converted to RGBA in place once the first seam has been found from the decoded colors.
+		imageToProcess.CurrentImage = &image.RGBA{Pix: source.Pix[source.PixOffset(bounds.Min.X, bounds.Min.Y):], Stride: source.Stride, Rect: image.Rect(0, 0, width, height)}
+		imageToProcess.SourceImage = source
+		imageToProcess.sharesSourcePix = true
+	default:
+		imageToProcess.copySourceImage(sourceImage)
+	}
+	return &imageToProcess
+}
+
+// LowMemory checks if the image was prepared with NewLowMemoryImageToProcess.
+func (imageToProcess *ImageToProcess) LowMemory() bool {
+	return imageToProcess.seamParents != nil
+}
+
+// releaseSourceImage stops reading colors from the decoded image. If the current image shares its buffer,
+// the colors are converted to RGBA first, the same way image.RGBA's Set converts them.
+func (imageToProcess *ImageToProcess) releaseSourceImage() {
+	if imageToProcess.sharesSourcePix {
+		pix, stride := imageToProcess.CurrentImage.Pix, imageToProcess.CurrentImage.Stride
+		for y := 0; y < imageToProcess.Height(); y++ {
+			for x := 0; x < imageToProcess.Width(); x++ {
+				i := y*stride + x*4
+				alpha := uint32(pix[i+3])
+				for channel := i; channel < i+3; channel++ {
+					color := uint32(pix[channel])
+					pix[channel] = uint8((color | color<<8) * alpha / 0xff >> 8)
+				}
+			}
+		}
+		imageToProcess.sharesSourcePix = false
+	}
+	imageToProcess.SourceImage = nil
+}
+
+// minParent returns which of the cells before, at and after the index in the last row (or column) has
+// the smallest cumulative magnitude, breaking ties in the same order as getMinMag.
+func minParent(magnitudes []float32, index, length int) int {
+	parent := index + 1
+	if index > 0 {
+		parent = index - 1
+	}
+	if magnitudes[parent] > magnitudes[index] {
+		parent = index
+	}
+	if index+1 < length && magnitudes[parent] > magnitudes[index+1] {
+		parent = index + 1
+	}
+	return parent
+}
+
+// minIndex returns the first index with the smallest magnitude.
+func minIndex(magnitudes []float32) (minIndex int) {
+	var minValue float32 = math.MaxFloat32
+	for index, magnitude := range magnitudes {
+		if magnitude < minValue {
+			minValue, minIndex = magnitude, index
+		}
+	}
+	return minIndex
+}
+
+// RemoveVerticalSeamLowMemory finds the same vertical seam as the standard path a row at a time and
+// removes it, leaving the image one column narrower, unless it's over the seam limit (see SetSeamLimit).
+func (imageToProcess *ImageToProcess) RemoveVerticalSeamLowMemory() {
+	width, height := imageToProcess.Width(), imageToProcess.Height()
+	previousRow, currentRow := imageToProcess.lowMemoryRows[0][:width], imageToProcess.lowMemoryRows[1][:width]
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			magnitude := imageToProcess.pixelMagnitude(x, y, width, height)
+			if y > 0 {
+				parent := minParent(previousRow, x, width)
+				magnitude += previousRow[parent]
+				imageToProcess.seamParents[imageToProcess.magnitudeIndex(x, y)] = int8(parent - x)
+			}
+			currentRow[x] = magnitude
+		}
+		previousRow, currentRow = currentRow, previousRow
+	}
+
+	// Follow the parents back up from the bottom of the seam.
+	seam := imageToProcess.seam[:height]
+	x := minIndex(previousRow)
+	cost := previousRow[x]
+	if imageToProcess.reachedSeamLimit(true, cost) {
+		return
+	}
+	for y := height - 1; y >= 0; y-- {
+		seam[y] = x
+		if y > 0 {
+			x += int(imageToProcess.seamParents[imageToProcess.magnitudeIndex(x, y)])
+		}
+	}
+
+	imageToProcess.releaseSourceImage()
+	recording := imageToProcess.recordingSeams()
+	if recording {
+		imageToProcess.recordSeam(true, cost)
+	}
+	pix, stride := imageToProcess.CurrentImage.Pix, imageToProcess.CurrentImage.Stride
+	for y, seamX := range seam {
+		copy(pix[y*stride+seamX*4:y*stride+(width-1)*4], pix[y*stride+(seamX+1)*4:])
+		if recording {
+			positions := imageToProcess.originalPositions[imageToProcess.magnitudeIndex(0, y):]
+			copy(positions[seamX:width-1], positions[seamX+1:])
+		}
+		for _, layer := range imageToProcess.layers {
+			layerPix, layerStride := layer.image.CurrentImage.Pix, layer.image.CurrentImage.Stride
+			copy(layerPix[y*layerStride+seamX*4:y*layerStride+(width-1)*4], layerPix[y*layerStride+(seamX+1)*4:])
+		}
+	}
+	imageToProcess.CurrentImage.Rect.Max.X--
+	imageToProcess.shrinkLayers(true)
+}
+
+// RemoveHorizontalSeamLowMemory finds the same horizontal seam as the standard path a column at a time and
+// removes it, leaving the image one row shorter, unless it's over the seam limit (see SetSeamLimit).
+func (imageToProcess *ImageToProcess) RemoveHorizontalSeamLowMemory() {
+	width, height := imageToProcess.Width(), imageToProcess.Height()
+	previousColumn, currentColumn := imageToProcess.lowMemoryRows[0][:height], imageToProcess.lowMemoryRows[1][:height]
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			magnitude := imageToProcess.pixelMagnitude(x, y, width, height)
+			if x > 0 {
+				parent := minParent(previousColumn, y, height)
+				magnitude += previousColumn[parent]
+				imageToProcess.seamParents[imageToProcess.magnitudeIndex(x, y)] = int8(parent - y)
+			}
+			currentColumn[y] = magnitude
+		}
+		previousColumn, currentColumn = currentColumn, previousColumn
+	}
+
+	// Follow the parents back from the right of the seam.
+	seam := imageToProcess.seam[:width]
+	y := minIndex(previousColumn)
+	cost := previousColumn[y]
+	if imageToProcess.reachedSeamLimit(false, cost) {
+		return
+	}
+	for x := width - 1; x >= 0; x-- {
+		seam[x] = y
+		if x > 0 {
+			y += int(imageToProcess.seamParents[imageToProcess.magnitudeIndex(x, y)])
+		}
+	}
+
+	imageToProcess.releaseSourceImage()
+	recording := imageToProcess.recordingSeams()
+	if recording {
+		imageToProcess.recordSeam(false, cost)
+	}
+	pix, stride := imageToProcess.CurrentImage.Pix, imageToProcess.CurrentImage.Stride
+	for x, seamY := range seam {
+		for y := seamY; y < height-1; y++ {
+			copy(pix[y*stride+x*4:y*stride+x*4+4], pix[(y+1)*stride+x*4:])
+			if recording {
+				imageToProcess.moveOriginalPosition(x, y+1, x, y)
+			}
+			imageToProcess.moveLayerPixels(x, y+1, x, y)
+		}
+	}
+	imageToProcess.CurrentImage.Rect.Max.Y--
+	imageToProcess.shrinkLayers(false)
+}
@@ -0,0 +1,46 @@
+package imagecontainer
+
+// SeamLimit is the most a seam can cost before the image stops being carved in its direction. If PerPixel is
+// set, the limit is on the seam's mean magnitude, its cost divided by its length, so vertical and horizontal
+// seams of different lengths are held to the same limit.
+type SeamLimit struct {
+	Cost     float32
+	PerPixel bool
+}
+
+// SetSeamLimit stops carving in a direction once the cheapest seam left costs more than the limit, instead of only
+// at the target dimensions, which become the smallest the image can be carved to.
+func (imageToProcess *ImageToProcess) SetSeamLimit(limit SeamLimit) {
+	imageToProcess.seamLimit = &limit
+}
+
+// ReachedSeamLimit checks the cost of the seam found by FindMinSeam at x, y against the limit set with
+// SetSeamLimit. If the seam costs more, the target in its direction is set to the current size so no more seams
+// are removed in that direction, and the seam should be left in the image.
+func (imageToProcess *ImageToProcess) ReachedSeamLimit(vertical bool, x, y int) bool {
+	return imageToProcess.reachedSeamLimit(vertical, imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)])
+}
+
+// reachedSeamLimit checks a seam's cost against the limit, stopping its direction if it's over.
+func (imageToProcess *ImageToProcess) reachedSeamLimit(vertical bool, cost float32) bool {
+	limit := imageToProcess.seamLimit
+	if limit == nil {
+		return false
+	}
+	length := imageToProcess.Width()
+	if vertical {
+		length = imageToProcess.Height()
+	}
+	if limit.PerPixel {
+		cost /= float32(length)
+	}
+	if cost <= limit.Cost {
+		return false
+	}
+	if vertical {
+		imageToProcess.TargetX = imageToProcess.Width()
+	} else {
+		imageToProcess.TargetY = imageToProcess.Height()
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package imagecontainer
+
+import (
+	"errors"
+	"image"
+)
+
+// ErrSeamMismatch is returned by ReplaySeam when a seam doesn't fit the image.
+var ErrSeamMismatch = errors.New("Seam doesn't fit the image")
+
+// Seam is a seam removed from an image and the sum of the magnitudes along it. Its points are in the
+// coordinates of the original image, one for each row of a vertical seam from the top down or for each
+// column of a horizontal seam from the left.
+type Seam struct {
+	Vertical bool
+	Cost     float32
+	Points   []image.Point
+}
+
+// RecordSeams keeps every seam removed from the image from now on (see Seams). It has to be called before
+// any seam is removed. To map the seams back to the original image, the original position of every pixel
+// is kept and shifted along with it, which takes another 4 bytes a pixel.
+func (imageToProcess *ImageToProcess) RecordSeams() {
+	height := imageToProcess.Height()
+	imageToProcess.originalPositions = make([]int32, imageToProcess.MagnitudeStride*height)
+	for index := range imageToProcess.originalPositions {
+		imageToProcess.originalPositions[index] = int32(index)
+	}
+	if imageToProcess.seam == nil {
+		longestSide := imageToProcess.Width()
+		if height > longestSide {
+			longestSide = height
+		}
+		imageToProcess.seam = make([]int, longestSide)
+	}
+}
+
+// Seams returns the seams removed since RecordSeams was called, in the order they were removed.
+func (imageToProcess *ImageToProcess) Seams() []Seam {
+	return imageToProcess.seams
+}
+
+// recordingSeams checks if RecordSeams has been called.
+func (imageToProcess *ImageToProcess) recordingSeams() bool {
+	return imageToProcess.originalPositions != nil
+}
+
+// recordSeam maps the seam in the seam buffer from the current coordinates to the original ones and keeps
+// it. For a vertical seam, the buffer holds the x of each row, and for a horizontal seam, the y of each column.
+// It has to be called before the seam is removed.
+func (imageToProcess *ImageToProcess) recordSeam(vertical bool, cost float32) {
+	length := imageToProcess.Width()
+	if vertical {
+		length = imageToProcess.Height()
+	}
+	seam := Seam{Vertical: vertical, Cost: cost, Points: make([]image.Point, length)}
+	for step, position := range imageToProcess.seam[:length] {
+		x, y := position, step
+		if !vertical {
+			x, y = step, position
+		}
+		original := int(imageToProcess.originalPositions[imageToProcess.magnitudeIndex(x, y)])
+		seam.Points[step] = imageToProcess.origin.Add(image.Pt(original%imageToProcess.MagnitudeStride, original/imageToProcess.MagnitudeStride))
+	}
+	imageToProcess.seams = append(imageToProcess.seams, seam)
+}
+
+// moveOriginalPosition keeps track of a pixel moved by removing a seam.
+func (imageToProcess *ImageToProcess) moveOriginalPosition(fromX, fromY, toX, toY int) {
+	imageToProcess.originalPositions[imageToProcess.magnitudeIndex(toX, toY)] = imageToProcess.originalPositions[imageToProcess.magnitudeIndex(fromX, fromY)]
+}
+
+// ReplaySeam removes a seam recorded from another image with the same original size, so the two images stay
+// aligned pixel for pixel. The seams have to be replayed in the order they were removed and no other seams can be
+// removed from the image, which has to be made with NewImageToProcess. Each point is looked up by its original
+// position and marked the same way a seam found in the image is, then removed with RemoveColumn or RemoveRow.
+func (imageToProcess *ImageToProcess) ReplaySeam(seam Seam) error {
+	if !imageToProcess.recordingSeams() {
+		imageToProcess.RecordSeams()
+	}
+	width, height := imageToProcess.Width(), imageToProcess.Height()
+	length, across := width, height
+	if seam.Vertical {
+		length, across = height, width
+	}
+	if len(seam.Points) != length {
+		return ErrSeamMismatch
+	}
+
+	for y := 0; y < height; y++ {
+		row := imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(0, y):imageToProcess.magnitudeIndex(width, y)]
+		for x := range row {
+			row[x] = 0
+		}
+	}
+	for step, point := range seam.Points {
+		point = point.Sub(imageToProcess.origin)
+		if point.X < 0 || point.X >= imageToProcess.MagnitudeStride {
+			return ErrSeamMismatch
+		}
+		original := int32(point.Y*imageToProcess.MagnitudeStride + point.X)
+		found := false
+		for position := 0; position < across && !found; position++ {
+			x, y := position, step
+			if !seam.Vertical {
+				x, y = step, position
+			}
+			if imageToProcess.originalPositions[imageToProcess.magnitudeIndex(x, y)] == original {
+				imageToProcess.CumulativeMagnitude[imageToProcess.magnitudeIndex(x, y)] = -1
+				found = true
+			}
+		}
+		if !found {
+			return ErrSeamMismatch
+		}
+	}
+
+	bounds := CompressionBounds{MaxX: width, MaxY: height}
+	if seam.Vertical {
+		imageToProcess.RemoveColumn(bounds)
+		imageToProcess.DropLastColumn()
+	} else {
+		imageToProcess.RemoveRow(bounds)
+		imageToProcess.DropLastRow()
+	}
+	return nil
+}
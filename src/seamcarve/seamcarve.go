@@ -0,0 +1,222 @@
+// Package seamcarve shrinks images by removing seams, paths of pixels through the image with the least energy,
+// so the parts of the image that stand out keep their shape. It's the engine behind the editor, for use
+// without going through files.
+package seamcarve
+
+import (
+	cp "compressionprocess"
+	"context"
+	"errors"
+	"image"
+	ic "imagecontainer"
+	"time"
+)
+
+// ErrInvalidSize is returned when the target size is bigger than the image or smaller than a pixel. Any size from
+// 1x1 up to the image's can be carved to.
+var ErrInvalidSize = errors.New("Invalid Target Dimensions.")
+
+// ErrLayerSize is returned when a layer isn't the same size as the image.
+var ErrLayerSize = ic.ErrLayerSize
+
+// ErrSeamMismatch is returned by Replay when a seam doesn't fit the image, such as when it's a different size from
+// the image the seams were removed from.
+var ErrSeamMismatch = ic.ErrSeamMismatch
+
+// EnergyFunc returns the energy of the pixel at x, y in the image being carved. The image's bounds start at
+// 0, 0 and shrink as seams are removed. It's called from several goroutines at once when Threads is more than 1.
+type EnergyFunc func(currentImage *image.RGBA, x, y int) float64
+
+// Options decides what size to carve an image down to and how.
+type Options struct {
+	// Width and Height are the size to carve the image down to. If either is 0, it's worked out from the
+	// scale instead, and if that's 0 too the dimension is left alone.
+	Width  int
+	Height int
+	// ScaleX and ScaleY are the size as a fraction of the image's, the same as the rates in a CSV.
+	ScaleX float64
+	ScaleY float64
+
+	// Energy replaces the gradient magnitude of the Sobel filters if it's set.
+	Energy EnergyFunc
+
+	// Threads splits every stage of each seam between that many goroutines. 0 or 1 carves the image on the
+	// calling goroutine.
+	Threads int
+	// LowMemory finds the same seams using about 5 bytes a pixel instead of 12, on a single goroutine. The
+	// image passed in is carved in place when it's an *image.RGBA or *image.NRGBA, so it can't be used after.
+	LowMemory bool
+
+	// RecordSeams returns every seam removed in the Result, which takes another 4 bytes a pixel while carving.
+	RecordSeams bool
+
+	// Layers are carved along with the image and returned in the Result.
+	Layers []Layer
+
+	// MaxSeamCost stops carving in a direction once the cheapest seam left costs more than the limit, making the
+	// size in the options the smallest the image is carved to (but never less than 3 pixels). A dimension left
+	// alone isn't carved, so set it to 1 to carve it as far as the limit allows.
+	MaxSeamCost *SeamCostLimit
+}
+
+// SeamCostLimit is a seam cost, or a percentile of the original image's energy that a seam's mean energy is held
+// to, for Options.MaxSeamCost.
+type SeamCostLimit = cp.SeamCostLimit
+
+// Layer is another image with the same size as the one carved, such as an alpha mask or depth map. The same seams
+// are removed from it so the two stay aligned. If Weight isn't 0, the layer's gradient magnitude times the weight
+// is added to the image's energy when finding seams.
+type Layer struct {
+	Image  image.Image
+	Weight float64
+}
+
+// Seam is a seam removed from an image. Its points are in the coordinates of the image passed to Carve, one
+// for each row of a vertical seam from the top down or for each column of a horizontal seam from the left.
+// The cost is the sum of the energy along the seam.
+type Seam struct {
+	Vertical bool
+	Cost     float64
+	Points   []image.Point
+}
+
+// Result describes a carve.
+type Result struct {
+	OriginalSize    image.Point
+	Size            image.Point
+	VerticalSeams   int
+	HorizontalSeams int
+	Duration        time.Duration
+	// Seams holds the seams removed, in the order they were removed, if RecordSeams was set.
+	Seams []Seam
+	// Layers holds the carved layers, in the same order as the options.
+	Layers []image.Image
+}
+
+// Carve removes seams from the image until it's the size in the options, alternating between horizontal and
+// vertical seams. If the context is done first, it stops at the next seam and returns the context's error.
+// The carved image is returned, or the image passed in if no seams needed removing.
+func Carve(ctx context.Context, img image.Image, opts Options) (image.Image, *Result, error) {
+	bounds := img.Bounds()
+	targetX, xErr := targetSize(bounds.Dx(), opts.Width, opts.ScaleX)
+	targetY, yErr := targetSize(bounds.Dy(), opts.Height, opts.ScaleY)
+	if xErr != nil || yErr != nil {
+		return nil, nil, ErrInvalidSize
+	}
+
+	if opts.MaxSeamCost != nil {
+		targetX, targetY = cp.LimitedSize(targetX, targetY)
+	}
+
+	start := time.Now()
+	var imageToProcess *ic.ImageToProcess
+	if opts.LowMemory {
+		imageToProcess = ic.NewLowMemoryImageToProcess("", img, targetX, targetY)
+	} else {
+		imageToProcess = ic.NewImageToProcess("", img, targetX, targetY)
+	}
+	if opts.Energy != nil {
+		imageToProcess.SetEnergy(func(currentImage *image.RGBA, x, y int) float32 {
+			return float32(opts.Energy(currentImage, x, y))
+		})
+	}
+	if opts.RecordSeams {
+		imageToProcess.RecordSeams()
+	}
+	for _, layer := range opts.Layers {
+		if err := imageToProcess.AddLayer(layer.Image, float32(layer.Weight)); err != nil {
+			return nil, nil, err
+		}
+	}
+	if opts.MaxSeamCost != nil {
+		var energy []float32
+		if opts.MaxSeamCost.Percentile {
+			energy = imageToProcess.Energy()
+		}
+		imageToProcess.SetSeamLimit(opts.MaxSeamCost.SeamLimit(energy))
+	}
+	if err := cp.CarveImage(ctx, imageToProcess, opts.Threads); err != nil {
+		return nil, nil, err
+	}
+
+	width, height := imageToProcess.Width(), imageToProcess.Height()
+	result := Result{
+		OriginalSize:    bounds.Size(),
+		Size:            image.Pt(width, height),
+		VerticalSeams:   bounds.Dx() - width,
+		HorizontalSeams: bounds.Dy() - height,
+		Duration:        time.Since(start),
+		Layers:          imageToProcess.Layers()}
+	for _, seam := range imageToProcess.Seams() {
+		result.Seams = append(result.Seams, Seam{Vertical: seam.Vertical, Cost: float64(seam.Cost), Points: seam.Points})
+	}
+	return imageToProcess.OutputImage(), &result, nil
+}
+
+// Replay removes seams recorded by Carve from another image with the same bounds as the one carved, such as a mask
+// or depth map, so the two stay aligned pixel for pixel. The seams have to be in the order they were removed.
+func Replay(ctx context.Context, img image.Image, seams []Seam) (image.Image, error) {
+	bounds := img.Bounds()
+	imageToProcess := ic.NewImageToProcess("", img, bounds.Dx(), bounds.Dy())
+	if err := cp.ReplaySeams(ctx, imageToProcess, imageSeams(seams)); err != nil {
+		return nil, err
+	}
+	return imageToProcess.OutputImage(), nil
+}
+
+// DrawSeams returns a copy of the image seams were removed from with the seams drawn on top, vertical seams in red
+// and horizontal seams in blue. If shaded, each seam is darker than the one removed before it.
+func DrawSeams(img image.Image, seams []Seam, shaded bool) image.Image {
+	style := cp.SolidOverlay
+	if shaded {
+		style = cp.ShadedOverlay
+	}
+	return cp.DrawSeams(img, imageSeams(seams), style)
+}
+
+// imageSeams converts seams returned by Carve back into the engine's seams.
+func imageSeams(seams []Seam) []ic.Seam {
+	converted := make([]ic.Seam, len(seams))
+	for i, seam := range seams {
+		converted[i] = ic.Seam{Vertical: seam.Vertical, Cost: float32(seam.Cost), Points: seam.Points}
+	}
+	return converted
+}
+
+// IndexMap records the order vertical seams were removed from an image, so it can be shrunk to any width down to
+// MinWidth with Reconstruct straight away, such as while serving a request.
+type IndexMap = cp.IndexMap
+
+// BuildIndexMap carves the image down to minWidth, splitting each seam between the number of threads given, and
+// returns the map of when each pixel was removed.
+func BuildIndexMap(ctx context.Context, img image.Image, minWidth, threads int) (*IndexMap, error) {
+	return cp.BuildIndexMap(ctx, img, minWidth, threads)
+}
+
+// ReadIndexMap reads a map written by the editor's index-map command, as a png or binary file.
+func ReadIndexMap(path string) (*IndexMap, error) {
+	return cp.ReadIndexMap(path)
+}
+
+// Reconstruct shrinks the image the map was built from to the width.
+func Reconstruct(img image.Image, indexMap *IndexMap, width int) (image.Image, error) {
+	output, err := indexMap.Reconstruct(img, width)
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// targetSize works out the size of a dimension from the size or scale asked for.
+func targetSize(size, target int, scale float64) (int, error) {
+	switch {
+	case target == 0 && scale == 0:
+		return size, nil
+	case target == 0:
+		target = int(float64(size) * scale)
+	}
+	if target < 1 || target > size {
+		return 0, ErrInvalidSize
+	}
+	return target, nil
+}
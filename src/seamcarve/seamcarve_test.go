@@ -0,0 +1,201 @@
+package seamcarve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// testImage draws random blocks of colour over noise, so the image has both edges and flat areas. LowMemory carves
+// an RGBA image in place, so every carve gets a new one.
+func testImage(width, height int, seed int64) *image.RGBA {
+	random := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	random.Read(img.Pix)
+	for block := 0; block < 4; block++ {
+		x, y := random.Intn(width), random.Intn(height)
+		blockColor := color.RGBA{uint8(random.Intn(256)), uint8(random.Intn(256)), uint8(random.Intn(256)), 255}
+		for by := y; by < y+height/3 && by < height; by++ {
+			for bx := x; bx < x+width/3 && bx < width; bx++ {
+				img.SetRGBA(bx, by, blockColor)
+			}
+		}
+	}
+	return img
+}
+
+// samePixels checks if two images have the same bounds and colours.
+func samePixels(a, b image.Image) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if color.RGBAModel.Convert(a.At(x, y)) != color.RGBAModel.Convert(b.At(x, y)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestCarveSizes(t *testing.T) {
+	sizes := []struct {
+		name string
+		opts Options
+		size image.Point
+	}{
+		{"width and height", Options{Width: 30, Height: 25}, image.Pt(30, 25)},
+		{"scale", Options{ScaleX: .5, ScaleY: .75}, image.Pt(20, 24)},
+		{"width over scale", Options{Width: 35, ScaleX: .5}, image.Pt(35, 32)},
+		{"width only", Options{Width: 28}, image.Pt(28, 32)},
+		{"height only", Options{ScaleY: .5}, image.Pt(40, 16)},
+		{"unchanged", Options{}, image.Pt(40, 32)},
+		{"a pixel", Options{Width: 1, Height: 1}, image.Pt(1, 1)},
+		{"two pixels", Options{Width: 2, Height: 2}, image.Pt(2, 2)},
+	}
+	for _, size := range sizes {
+		t.Run(size.name, func(t *testing.T) {
+			output, result, err := Carve(context.Background(), testImage(40, 32, 1), size.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output.Bounds() != (image.Rectangle{Max: size.size}) || result.Size != size.size {
+				t.Fatalf("carved to %v with a result of %v, not %v", output.Bounds(), result.Size, size.size)
+			}
+			if result.OriginalSize != image.Pt(40, 32) || result.VerticalSeams != 40-size.size.X ||
+				result.HorizontalSeams != 32-size.size.Y {
+				t.Fatalf("result %+v", result)
+			}
+		})
+	}
+}
+
+func TestCarveInvalidSize(t *testing.T) {
+	for _, opts := range []Options{
+		{Width: 41}, {Height: 33}, {Width: -1}, {ScaleX: 1.5}, {ScaleY: .01}, {ScaleX: -.5},
+	} {
+		if _, _, err := Carve(context.Background(), testImage(40, 32, 1), opts); !errors.Is(err, ErrInvalidSize) {
+			t.Errorf("%+v: got %v instead of ErrInvalidSize", opts, err)
+		}
+	}
+}
+
+func TestCarveMatchesSerial(t *testing.T) {
+	opts := Options{Width: 27, Height: 21, RecordSeams: true}
+	expected, expectedResult, err := Carve(context.Background(), testImage(40, 32, 2), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, threads := range []int{2, 3, 4, 8} {
+		opts.Threads = threads
+		output, result, err := Carve(context.Background(), testImage(40, 32, 2), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !samePixels(output, expected) || !reflect.DeepEqual(result.Seams, expectedResult.Seams) {
+			t.Errorf("p=%d differs from the serial carve", threads)
+		}
+	}
+
+	opts.Threads, opts.LowMemory = 0, true
+	output, result, err := Carve(context.Background(), testImage(40, 32, 2), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePixels(output, expected) || !reflect.DeepEqual(result.Seams, expectedResult.Seams) {
+		t.Error("LowMemory differs from the serial carve")
+	}
+}
+
+func TestReplayMatchesCarve(t *testing.T) {
+	for _, size := range []image.Point{{30, 32}, {40, 20}, {25, 19}, {1, 1}} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			output, result, err := Carve(context.Background(), testImage(40, 32, 3), Options{Width: size.X, Height: size.Y, RecordSeams: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Seams) != result.VerticalSeams+result.HorizontalSeams {
+				t.Fatalf("recorded %d seams for %d removed", len(result.Seams), result.VerticalSeams+result.HorizontalSeams)
+			}
+			replayed, err := Replay(context.Background(), testImage(40, 32, 3), result.Seams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !samePixels(replayed, output) {
+				t.Error("replaying the seams differs from the carve")
+			}
+		})
+	}
+
+	if _, err := Replay(context.Background(), testImage(20, 32, 3), carvedSeams(t)); !errors.Is(err, ErrSeamMismatch) {
+		t.Errorf("replaying on a smaller image got %v instead of ErrSeamMismatch", err)
+	}
+}
+
+// carvedSeams returns the seams removed carving a 40x32 test image to 30x24.
+func carvedSeams(t *testing.T) []Seam {
+	_, result, err := Carve(context.Background(), testImage(40, 32, 3), Options{Width: 30, Height: 24, RecordSeams: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Seams
+}
+
+func TestCarveLayers(t *testing.T) {
+	opts := Options{Width: 29, Height: 23, RecordSeams: true}
+	_, plain, err := Carve(context.Background(), testImage(40, 32, 4), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A layer without a weight is only carved, so it's the same as replaying the image's seams on it.
+	opts.Layers = []Layer{{Image: testImage(40, 32, 5)}, {Image: testImage(40, 32, 6), Weight: 0}}
+	_, result, err := Carve(context.Background(), testImage(40, 32, 4), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Seams, plain.Seams) {
+		t.Error("a layer without a weight changed the seams")
+	}
+	if len(result.Layers) != 2 {
+		t.Fatalf("got %d layers back", len(result.Layers))
+	}
+	for i, layer := range result.Layers {
+		replayed, err := Replay(context.Background(), testImage(40, 32, int64(5+i)), result.Seams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !samePixels(layer, replayed) {
+			t.Errorf("layer %d isn't carved along the image's seams", i)
+		}
+	}
+
+	// A weighted layer adds its energy, so the seams follow it and the layer stays aligned with the image.
+	opts.Layers = []Layer{{Image: testImage(40, 32, 5), Weight: 4}}
+	_, weighted, err := Carve(context.Background(), testImage(40, 32, 4), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(weighted.Seams, plain.Seams) {
+		t.Error("a weighted layer didn't change the seams")
+	}
+	replayed, err := Replay(context.Background(), testImage(40, 32, 5), weighted.Seams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePixels(weighted.Layers[0], replayed) {
+		t.Error("the weighted layer isn't carved along the image's seams")
+	}
+
+	opts.Layers = []Layer{{Image: testImage(40, 31, 5)}}
+	if _, _, err := Carve(context.Background(), testImage(40, 32, 4), opts); !errors.Is(err, ErrLayerSize) {
+		t.Errorf("a layer of the wrong size got %v instead of ErrLayerSize", err)
+	}
+}